@@ -6,8 +6,15 @@ import (
 	"time"
 
 	"github.com/carlosEA28/Social/internal/auth"
+	"github.com/carlosEA28/Social/internal/events"
 	"github.com/carlosEA28/Social/internal/mail"
+	"github.com/carlosEA28/Social/internal/ranking"
 	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/carlosEA28/Social/internal/repository/cache"
+	"github.com/carlosEA28/Social/internal/signer"
+	"github.com/carlosEA28/Social/internal/storage"
+	"github.com/carlosEA28/Social/internal/stream"
+	"github.com/carlosEA28/Social/internal/webhook"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -21,6 +28,15 @@ type app struct {
 	logger        *zap.SugaredLogger
 	mail          mail.Client
 	authenticator auth.Authenticator
+	blobs         storage.Blob
+	cursors       *signer.Signer
+	cacheStorage  cache.Storage
+	scorer        ranking.Scorer
+	events        *events.Bus
+	hub           *stream.Hub
+	unsubscribes  *signer.Signer
+	streamTickets *signer.Signer
+	webhooks      *webhook.Client
 }
 
 type config struct {
@@ -30,6 +46,76 @@ type config struct {
 	mail        mailConfig
 	frontendURL string
 	auth        AuthConfig
+	scheduler   schedulerConfig
+	storage     storageConfig
+	redisCfg    redisConfig
+	timeline    timelineConfig
+	feed        feedConfig
+	events      eventsConfig
+	stream      streamConfig
+	webhooks    webhooksConfig
+}
+
+type webhooksConfig struct {
+	interval time.Duration
+	workers  int
+	timeout  time.Duration
+	// a failed delivery is retried maxAttempts times in all, waiting backoff
+	// after the first attempt and twice as long after each of the next
+	maxAttempts int
+	backoff     time.Duration
+	// disableAfter is how many attempts in a row may fail before the webhook is
+	// disabled
+	disableAfter int
+	retention    time.Duration
+	// allowPrivate lets webhooks reach private addresses, for development
+	allowPrivate bool
+}
+
+type streamConfig struct {
+	heartbeat time.Duration
+	retention time.Duration
+}
+
+type eventsConfig struct {
+	workers   int
+	queueSize int
+}
+
+type feedConfig struct {
+	ranking    string
+	window     time.Duration
+	candidates int
+}
+
+type redisConfig struct {
+	addr    string
+	pw      string
+	db      int
+	enabled bool
+}
+
+type timelineConfig struct {
+	celebrityThreshold int64
+	// workers timeline jobs run at a time, looking for due ones every interval
+	workers  int
+	interval time.Duration
+	// lease is how long a job may run before another worker retries it
+	lease        time.Duration
+	backfillSize int
+}
+
+type storageConfig struct {
+	dir            string
+	maxUploadBytes int64
+	maxPerPost     int
+	thumbnailSize  int
+}
+
+type schedulerConfig struct {
+	interval       time.Duration
+	batchSize      int
+	trashRetention time.Duration
 }
 
 type AuthConfig struct {
@@ -45,6 +131,11 @@ type TokenConfig struct {
 type mailConfig struct {
 	mailtrap mailtrapConfig
 	exp      time.Duration
+	// throttle is how long a notification mailed as it happened waits before
+	// new activity on it is mailed again, interval how often they are looked for.
+	throttle   time.Duration
+	interval   time.Duration
+	digestSize int
 }
 
 type mailtrapConfig struct {
@@ -65,8 +156,8 @@ func (app *app) mount() http.Handler {
 	r.Use(cors.Handler(cors.Options{
 
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Last-Event-ID"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300,
@@ -74,14 +165,22 @@ func (app *app) mount() http.Handler {
 
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(stripStreamTicket)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
-	r.Use(middleware.Timeout(60 * time.Second))
+	// streams stay open for as long as the client listens, so they are routed
+	// outside of the request timeout of the rest of the API
+	r.With(app.streamAuthMiddleware).Get("/v1/stream", app.streamHandler)
+	r.With(app.streamAuthMiddleware, app.postContextMiddleware).Get("/v1/posts/{postId}/live", app.liveCommentsHandler)
 
 	r.Route("/v1", func(r chi.Router) {
+		r.Use(middleware.Timeout(60 * time.Second))
+
 		r.Get("/health", app.healthCheckHandler)
 
+		r.With(app.AuthTokenMiddleware).Post("/stream/tickets", app.createStreamTicketHandler)
+
 		docsUrl := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsUrl)))
 
@@ -89,25 +188,154 @@ func (app *app) mount() http.Handler {
 			r.Use(app.AuthTokenMiddleware)
 			r.Post("/", app.createPostHandler)
 
+			r.Route("/trash", func(r chi.Router) {
+				r.Get("/", app.getTrashHandler)
+				r.Put("/{postId}/restore", app.restorePostHandler)
+			})
+
 			r.Route("/{postId}", func(r chi.Router) {
 				r.Use(app.postContextMiddleware) //usando middleware
 
 				r.Get("/", app.getPostHandler)
 				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
 				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+
+				r.Post("/comments", app.createCommentHandler)
+				r.Route("/comments/{commentId}", func(r chi.Router) {
+					r.Use(app.commentContextMiddleware)
+
+					r.Patch("/", app.updateCommentHandler)
+					r.Delete("/", app.deleteCommentHandler)
+				})
+
+				r.Put("/reactions", app.setReactionHandler)
+				r.Delete("/reactions", app.removeReactionHandler)
+
+				r.Put("/pin", app.pinPostHandler)
+				r.Delete("/pin", app.unpinPostHandler)
+
+				r.Get("/revisions", app.getPostRevisionsHandler)
+				r.Get("/revisions/diff", app.getPostRevisionDiffHandler)
+
+				r.Post("/attachments", app.checkPostOwnership("admin", app.uploadAttachmentsHandler))
+				r.Delete("/attachments/{attachmentId}", app.checkPostOwnership("admin", app.deleteAttachmentHandler))
 			})
 
 		})
 
+		r.Route("/tags", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/trending", app.getTrendingTagsHandler)
+			r.Get("/{tag}/posts", app.getTagPostsHandler)
+		})
+
+		r.With(app.AuthTokenMiddleware).Get("/search", app.searchHandler)
+
+		r.Route("/attachments/{attachmentId}", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.attachmentContextMiddleware)
+
+			r.Get("/", app.getAttachmentHandler)
+			r.Get("/thumbnail", app.getAttachmentThumbnailHandler)
+		})
+
+		r.Route("/notifications", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/", app.getNotificationsHandler)
+			r.Put("/read", app.markAllNotificationsReadHandler)
+			r.Put("/{notificationId}/read", app.markNotificationReadHandler)
+		})
+
+		r.Route("/conversations", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/", app.getConversationsHandler)
+			r.Post("/", app.createConversationHandler)
+
+			r.Route("/{conversationId}", func(r chi.Router) {
+				r.Use(app.conversationContextMiddleware)
+
+				r.Get("/", app.getConversationHandler)
+				r.Get("/messages", app.getMessagesHandler)
+				r.Post("/messages", app.createMessageHandler)
+				r.Put("/read", app.markConversationReadHandler)
+			})
+		})
+
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/", app.getWebhooksHandler)
+			r.Post("/", app.createWebhookHandler)
+
+			r.Route("/{webhookId}", func(r chi.Router) {
+				r.Use(app.webhookContextMiddleware)
+
+				r.Get("/", app.getWebhookHandler)
+				r.Patch("/", app.updateWebhookHandler)
+				r.Delete("/", app.deleteWebhookHandler)
+
+				r.Get("/deliveries", app.getWebhookDeliveriesHandler)
+				r.Get("/deliveries/{deliveryId}", app.getWebhookDeliveryHandler)
+				r.Post("/deliveries/{deliveryId}/redeliver", app.redeliverWebhookHandler)
+			})
+		})
+
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Put("/unsubscribe/{token}", app.unsubscribeHandler)
+
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+
+				r.Patch("/", app.updateProfileHandler)
+				r.Get("/drafts", app.getDraftsHandler)
+				r.Get("/mentions", app.getMentionsHandler)
+
+				r.Get("/bookmarks", app.getBookmarksHandler)
+				r.Put("/bookmarks/{postId}", app.bookmarkPostHandler)
+				r.Delete("/bookmarks/{postId}", app.removeBookmarkHandler)
+
+				r.Route("/bookmark-collections", func(r chi.Router) {
+					r.Get("/", app.getBookmarkCollectionsHandler)
+					r.Post("/", app.createBookmarkCollectionHandler)
+					r.Patch("/{collectionId}", app.renameBookmarkCollectionHandler)
+					r.Delete("/{collectionId}", app.deleteBookmarkCollectionHandler)
+				})
+
+				r.Get("/email-preferences", app.getEmailPreferencesHandler)
+				r.Patch("/email-preferences", app.updateEmailPreferencesHandler)
+
+				r.Get("/blocks", app.getBlocksHandler)
+				r.Put("/blocks/{userId}", app.blockUserHandler)
+				r.Delete("/blocks/{userId}", app.unblockUserHandler)
+
+				r.Get("/mutes", app.getMutesHandler)
+				r.Put("/mutes/{userId}", app.muteUserHandler)
+				r.Delete("/mutes/{userId}", app.unmuteUserHandler)
+
+				r.Route("/follow-requests", func(r chi.Router) {
+					r.Get("/", app.getIncomingFollowRequestsHandler)
+					r.Get("/sent", app.getOutgoingFollowRequestsHandler)
+					r.Put("/{userId}", app.approveFollowRequestHandler)
+					r.Delete("/{userId}", app.rejectFollowRequestHandler)
+				})
+			})
+
+			r.With(app.AuthTokenMiddleware).Get("/suggestions", app.getSuggestionsHandler)
 
 			r.Route("/{userId}", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.userContextMiddleware)
 
 				r.Get("/", app.getUserHandler)
+				r.Get("/followers", app.getFollowersHandler)
+				r.Get("/following", app.getFollowingHandler)
+				r.Get("/posts", app.getUserPostsHandler)
 				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+				r.Delete("/follow", app.unfollowUserHandler)
 			})
 
 			r.Group(func(r chi.Router) {
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/carlosEA28/Social/internal/media"
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/carlosEA28/Social/internal/storage"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type attachmentKey string
+
+const attachmentCtx attachmentKey = "attachment"
+
+var (
+	allowedAttachmentTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp", "video/mp4", "application/pdf"}
+	thumbnailTypes         = []string{"image/jpeg", "image/png", "image/gif"}
+
+	errInvalidAttachment = errors.New("invalid attachment")
+)
+
+func (app *app) uploadAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+	cfg := app.config.storage
+
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.maxUploadBytes*int64(cfg.maxPerPost)+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		app.badRequetResponse(w, r, errors.New("no file was sent in the file field"))
+		return
+	}
+
+	ctx := r.Context()
+
+	// the limit is enforced when the rows are inserted, this only spares
+	// processing files that could never be kept
+	count, err := app.store.Attachments.CountByPostId(ctx, post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if count+len(files) > cfg.maxPerPost {
+		app.badRequetResponse(w, r, fmt.Errorf("a post can have at most %d attachments", cfg.maxPerPost))
+		return
+	}
+
+	// every file is checked before anything is stored so a bad one doesn't leave
+	// the others behind
+	uploads := make([]*attachmentUpload, 0, len(files))
+	for _, fh := range files {
+		upload, err := app.prepareAttachment(post.ID, user.ID, fh)
+		if err != nil {
+			switch {
+			case errors.Is(err, errInvalidAttachment):
+				app.badRequetResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		uploads = append(uploads, upload)
+	}
+
+	attachments := make([]*repository.Attachment, 0, len(uploads))
+	for _, upload := range uploads {
+		if err := app.putAttachment(ctx, upload); err != nil {
+			app.deleteAllBlobs(ctx, attachments)
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		attachments = append(attachments, upload.attachment)
+	}
+
+	if err := app.store.Attachments.Create(ctx, post.ID, attachments, cfg.maxPerPost); err != nil {
+		app.deleteAllBlobs(ctx, attachments)
+
+		switch {
+		case errors.Is(err, repository.ErrorTooManyAttachments):
+			app.badRequetResponse(w, r, fmt.Errorf("a post can have at most %d attachments", cfg.maxPerPost))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	for _, attachment := range attachments {
+		setAttachmentURLs(attachment)
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, attachments); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// attachmentUpload is an uploaded file that passed validation, along with its
+// thumbnail when it gets one, waiting to be stored.
+type attachmentUpload struct {
+	file       *multipart.FileHeader
+	attachment *repository.Attachment
+	thumbnail  []byte
+}
+
+// prepareAttachment checks the size and sniffed type of an uploaded file and
+// renders its thumbnail, nothing is stored yet.
+func (app *app) prepareAttachment(postId, userId int64, fh *multipart.FileHeader) (*attachmentUpload, error) {
+	if fh.Size > app.config.storage.maxUploadBytes {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", errInvalidAttachment, fh.Filename, app.config.storage.maxUploadBytes)
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// never trust the client content type, sniff the bytes instead
+	mtype, err := mimetype.DetectReader(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if !mimeIn(mtype, allowedAttachmentTypes) {
+		return nil, fmt.Errorf("%w: %s files are not allowed", errInvalidAttachment, mtype.String())
+	}
+
+	name := uuid.New().String()
+	upload := &attachmentUpload{
+		file: fh,
+		attachment: &repository.Attachment{
+			PostID:     postId,
+			UserID:     userId,
+			FileName:   filepath.Base(fh.Filename),
+			MimeType:   mtype.String(),
+			Size:       fh.Size,
+			StorageKey: fmt.Sprintf("posts/%d/%s%s", postId, name, mtype.Extension()),
+		},
+	}
+
+	if mimeIn(mtype, thumbnailTypes) {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		img, err := media.Process(file, app.config.storage.thumbnailSize)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidAttachment, err)
+		}
+
+		thumbnailKey := fmt.Sprintf("posts/%d/%s_thumb.jpg", postId, name)
+		upload.thumbnail = img.Thumbnail
+		upload.attachment.ThumbnailKey = &thumbnailKey
+		upload.attachment.Width = &img.Width
+		upload.attachment.Height = &img.Height
+	}
+
+	return upload, nil
+}
+
+// putAttachment stores the blobs of upload, removing those it stored if it fails.
+func (app *app) putAttachment(ctx context.Context, upload *attachmentUpload) error {
+	attachment := upload.attachment
+
+	if attachment.ThumbnailKey != nil {
+		if err := app.blobs.Put(ctx, *attachment.ThumbnailKey, bytes.NewReader(upload.thumbnail)); err != nil {
+			return err
+		}
+	}
+
+	file, err := upload.file.Open()
+	if err != nil {
+		app.deleteBlobs(ctx, attachment)
+		return err
+	}
+	defer file.Close()
+
+	if err := app.blobs.Put(ctx, attachment.StorageKey, file); err != nil {
+		app.deleteBlobs(ctx, attachment)
+		return err
+	}
+
+	return nil
+}
+
+func (app *app) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "attachmentId"), 10, 64)
+	if err != nil {
+		app.badRequetResponse(w, r, errors.New("invalid attachment ID"))
+		return
+	}
+
+	ctx := r.Context()
+
+	attachment, err := app.store.Attachments.GetById(ctx, id)
+	if err != nil || attachment.PostID != post.ID {
+		switch {
+		case err == nil, errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, repository.ErrorNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Attachments.Delete(ctx, attachment.ID); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.deleteBlobs(ctx, attachment)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *app) getAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment := getAttachmentFromCtx(r)
+	app.serveBlob(w, r, attachment.StorageKey, attachment.MimeType)
+}
+
+func (app *app) getAttachmentThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	attachment := getAttachmentFromCtx(r)
+	if attachment.ThumbnailKey == nil {
+		app.notFounResponse(w, r, repository.ErrorNotFound)
+		return
+	}
+
+	app.serveBlob(w, r, *attachment.ThumbnailKey, "image/jpeg")
+}
+
+func (app *app) serveBlob(w http.ResponseWriter, r *http.Request, key, contentType string) {
+	blob, err := app.blobs.Open(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if _, err := io.Copy(w, blob); err != nil {
+		app.logger.Errorw("error streaming attachment", "key", key, "error", err)
+	}
+}
+
+// attachmentContextMiddleware loads the attachment and makes sure its post is visible to the caller.
+func (app *app) attachmentContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "attachmentId"), 10, 64)
+		if err != nil {
+			app.badRequetResponse(w, r, errors.New("invalid attachment ID"))
+			return
+		}
+
+		ctx := r.Context()
+
+		attachment, err := app.store.Attachments.GetById(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrorNotFound):
+				app.notFounResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		post, err := app.store.Posts.GetById(ctx, attachment.PostID)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrorNotFound):
+				app.notFounResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		visible, err := app.canSeePost(ctx, getUserFromContext(r), post)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !visible {
+			app.notFounResponse(w, r, repository.ErrorNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, attachmentCtx, attachment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getAttachmentFromCtx(r *http.Request) *repository.Attachment {
+	attachment, _ := r.Context().Value(attachmentCtx).(*repository.Attachment)
+	return attachment
+}
+
+func (app *app) deleteBlobs(ctx context.Context, attachment *repository.Attachment) {
+	keys := []string{attachment.StorageKey}
+	if attachment.ThumbnailKey != nil {
+		keys = append(keys, *attachment.ThumbnailKey)
+	}
+
+	for _, key := range keys {
+		if err := app.blobs.Delete(ctx, key); err != nil {
+			app.logger.Errorw("error deleting blob", "key", key, "error", err)
+		}
+	}
+}
+
+func (app *app) deleteAllBlobs(ctx context.Context, attachments []*repository.Attachment) {
+	for _, attachment := range attachments {
+		app.deleteBlobs(ctx, attachment)
+	}
+}
+
+func setAttachmentURLs(attachment *repository.Attachment) {
+	attachment.URL = fmt.Sprintf("/v1/attachments/%d", attachment.ID)
+	if attachment.ThumbnailKey != nil {
+		attachment.ThumbnailURL = attachment.URL + "/thumbnail"
+	}
+}
+
+func mimeIn(mtype *mimetype.MIME, allowed []string) bool {
+	for _, t := range allowed {
+		if mtype.Is(t) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	errBlockSelf      = errors.New("users can't block or mute themselves")
+	errMuteExpiryPast = errors.New("expires_at must be in the future")
+)
+
+type MutePayload struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (app *app) getBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	app.relatedUsersResponse(w, r, app.store.Blocks.GetBlocked)
+}
+
+func (app *app) getMutesHandler(w http.ResponseWriter, r *http.Request) {
+	app.relatedUsersResponse(w, r, app.store.Mutes.GetMuted)
+}
+
+// blockUserHandler blocks the user in the URL, which also ends any follow
+// between them and the caller in both directions.
+func (app *app) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	targetId, ok := app.relatedUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	if err := app.store.Blocks.Block(ctx, user.ID, targetId); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.enqueueTimelineRemoval(ctx, user.ID, targetId)
+	app.enqueueTimelineRemoval(ctx, targetId, user.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *app) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	targetId, ok := app.relatedUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.store.Blocks.Unblock(r.Context(), getUserFromContext(r).ID, targetId); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// muteUserHandler hides the user in the URL from the caller's feeds, until the
+// optional expires_at of the body or until unmuted.
+func (app *app) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	targetId, ok := app.relatedUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	var payload MutePayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		app.badRequetResponse(w, r, errMuteExpiryPast)
+		return
+	}
+
+	if err := app.store.Mutes.Mute(r.Context(), getUserFromContext(r).ID, targetId, payload.ExpiresAt); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *app) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	targetId, ok := app.relatedUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.store.Mutes.Unmute(r.Context(), getUserFromContext(r).ID, targetId); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// relatedUserParam reads the userId URL param of the block and mute routes,
+// writing the error response itself when it isn't another existing user.
+func (app *app) relatedUserParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequetResponse(w, r, errors.New("invalid user ID"))
+		return 0, false
+	}
+
+	if id == getUserFromContext(r).ID {
+		app.badRequetResponse(w, r, errBlockSelf)
+		return 0, false
+	}
+
+	if _, err := app.store.Users.GetUserById(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return 0, false
+	}
+
+	return id, true
+}
+
+type relatedUsersFunc func(context.Context, int64, repository.PaginatedFeedQuery) ([]repository.RelatedUser, error)
+
+func (app *app) relatedUsersResponse(w http.ResponseWriter, r *http.Request, list relatedUsersFunc) {
+	fq, err := app.parseUnfilteredPagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	users, err := list(r.Context(), getUserFromContext(r).ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var next *repository.Cursor
+	if n := len(users); n > 0 {
+		next = nextCursor(fq, n, users[n-1].CreatedAt, users[n-1].ID)
+	}
+
+	if err := app.paginatedResponse(w, r, users, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *app) purgeExpiredMutes(ctx context.Context) error {
+	purged, err := app.store.Mutes.PurgeExpired(ctx)
+	if err != nil {
+		return err
+	}
+
+	if purged > 0 {
+		app.logger.Infow("expired mutes purged", "count", purged)
+	}
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+type BookmarkPayload struct {
+	// CollectionID files the bookmark in one of the caller's collections, or
+	// outside of any when null. Left out, a new bookmark is kept outside of any
+	// and an existing one stays where it is.
+	CollectionID optionalID `json:"collection_id"`
+}
+
+// optionalID tells a null ID apart from one that was left out of the body.
+type optionalID struct {
+	Set bool
+	ID  *int64
+}
+
+func (o *optionalID) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.ID)
+}
+
+type BookmarkCollectionPayload struct {
+	Name string `json:"name" validate:"required,max=50"`
+}
+
+// getBookmarksHandler lists the caller's bookmarks, the most recently saved
+// first, only those of a collection with ?collection=. Bookmarks of posts that
+// were deleted or became invisible are listed as unavailable, without the post.
+func (app *app) getBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := app.parsePagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	var collectionId *int64
+	if raw := r.URL.Query().Get("collection"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			app.badRequetResponse(w, r, fmt.Errorf("invalid collection %q", raw))
+			return
+		}
+
+		if _, err := app.store.Bookmarks.GetCollection(ctx, user.ID, id); err != nil {
+			switch {
+			case errors.Is(err, repository.ErrorNotFound):
+				app.notFounResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		collectionId = &id
+	}
+
+	bookmarks, err := app.store.Bookmarks.Get(ctx, user.ID, collectionId, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var posts []*repository.Post
+	for _, b := range bookmarks {
+		if b.Post != nil {
+			posts = append(posts, &b.Post.Post)
+		}
+	}
+
+	if err := app.hydratePosts(ctx, posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var next *repository.Cursor
+	if n := len(bookmarks); n > 0 {
+		next = nextCursor(fq, n, bookmarks[n-1].CreatedAt, bookmarks[n-1].PostID)
+	}
+
+	if err := app.paginatedResponse(w, r, bookmarks, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// bookmarkPostHandler bookmarks a post the caller can see, or moves an existing
+// bookmark to the collection in the body when it has one.
+func (app *app) bookmarkPostHandler(w http.ResponseWriter, r *http.Request) {
+	postId, err := strconv.ParseInt(chi.URLParam(r, "postId"), 10, 64)
+	if err != nil {
+		app.badRequetResponse(w, r, errors.New("invalid post ID"))
+		return
+	}
+
+	var payload BookmarkPayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	post, err := app.store.Posts.GetById(ctx, postId)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	visible, err := app.canSeePost(ctx, user, post)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !visible || !post.IsPublished() {
+		app.notFounResponse(w, r, repository.ErrorNotFound)
+		return
+	}
+
+	if payload.CollectionID.ID != nil {
+		if _, err := app.store.Bookmarks.GetCollection(ctx, user.ID, *payload.CollectionID.ID); err != nil {
+			switch {
+			case errors.Is(err, repository.ErrorNotFound):
+				app.badRequetResponse(w, r, errors.New("collection_id must be one of your collections"))
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	}
+
+	if err := app.store.Bookmarks.Set(ctx, user.ID, post.ID, payload.CollectionID.ID, payload.CollectionID.Set); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeBookmarkHandler removes a bookmark, also of posts that are no longer available.
+func (app *app) removeBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	postId, err := strconv.ParseInt(chi.URLParam(r, "postId"), 10, 64)
+	if err != nil {
+		app.badRequetResponse(w, r, errors.New("invalid post ID"))
+		return
+	}
+
+	if err := app.store.Bookmarks.Remove(r.Context(), getUserFromContext(r).ID, postId); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *app) getBookmarkCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	collections, err := app.store.Bookmarks.GetCollections(r.Context(), getUserFromContext(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collections); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *app) createBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload BookmarkCollectionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	collection := &repository.BookmarkCollection{
+		UserID: getUserFromContext(r).ID,
+		Name:   payload.Name,
+	}
+
+	if err := app.store.Bookmarks.CreateCollection(r.Context(), collection); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorDuplicateCollection):
+			app.badRequetResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, collection); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *app) renameBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "collectionId"), 10, 64)
+	if err != nil {
+		app.badRequetResponse(w, r, errors.New("invalid collection ID"))
+		return
+	}
+
+	var payload BookmarkCollectionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	err = app.store.Bookmarks.RenameCollection(ctx, &repository.BookmarkCollection{ID: id, UserID: user.ID, Name: payload.Name})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		case errors.Is(err, repository.ErrorDuplicateCollection):
+			app.badRequetResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	collection, err := app.store.Bookmarks.GetCollection(ctx, user.ID, id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collection); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteBookmarkCollectionHandler deletes a collection, its bookmarks are kept
+// outside of any collection.
+func (app *app) deleteBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "collectionId"), 10, 64)
+	if err != nil {
+		app.badRequetResponse(w, r, errors.New("invalid collection ID"))
+		return
+	}
+
+	if err := app.store.Bookmarks.DeleteCollection(r.Context(), getUserFromContext(r).ID, id); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/carlosEA28/Social/internal/events"
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+type CreateCommentPayload struct {
+	Content  string `json:"content" validate:"required,max=1000"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+type UpdateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
+var errParentComment = errors.New("parent_id must be a comment of the same post")
+
+func (app *app) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	if !post.IsPublished() {
+		app.badRequetResponse(w, r, errors.New("comments are only allowed on published posts"))
+		return
+	}
+
+	var payload CreateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	if payload.ParentID != nil {
+		parent, err := app.store.Comment.GetById(ctx, *payload.ParentID)
+		if err != nil && !errors.Is(err, repository.ErrorNotFound) {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if parent == nil || parent.PostID != post.ID {
+			app.badRequetResponse(w, r, errParentComment)
+			return
+		}
+	}
+
+	comment := &repository.Comment{
+		PostID:   post.ID,
+		ParentID: payload.ParentID,
+		UserID:   user.ID,
+		Content:  payload.Content,
+		User: repository.User{
+			ID:       user.ID,
+			Username: user.Username,
+		},
+	}
+
+	if err := app.store.Comment.Create(ctx, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.events.Publish(ctx, events.Event{Type: events.CommentCreated, ActorID: user.ID, PostID: post.ID, CommentID: comment.ID})
+
+	comment.Entities.Hashtags = hashtagEntities(comment.Content)
+
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// updateCommentHandler lets the author of a comment change its content.
+func (app *app) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+	user := getUserFromContext(r)
+
+	if comment.UserID != user.ID {
+		app.forbidenResponse(w, r)
+		return
+	}
+
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	comment.Content = payload.Content
+
+	if err := app.store.Comment.Update(ctx, comment); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.events.Publish(ctx, events.Event{Type: events.CommentUpdated, ActorID: user.ID, PostID: comment.PostID, CommentID: comment.ID})
+
+	comment.Entities.Hashtags = hashtagEntities(comment.Content)
+
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteCommentHandler removes a comment and its replies. Besides its author, the
+// author of the post and moderators can remove it.
+func (app *app) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	if comment.UserID != user.ID && post.UserId != user.ID {
+		allowed, err := app.checkRolePrecedence(ctx, user, "moderator")
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbidenResponse(w, r)
+			return
+		}
+	}
+
+	if err := app.store.Comment.Delete(ctx, comment.ID); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.events.Publish(ctx, events.Event{Type: events.CommentDeleted, ActorID: user.ID, PostID: comment.PostID, CommentID: comment.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commentContextMiddleware loads the comment in the URL, which must belong to the
+// post loaded by postContextMiddleware.
+func (app *app) commentContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "commentId"), 10, 64)
+		if err != nil {
+			app.badRequetResponse(w, r, errors.New("invalid comment ID"))
+			return
+		}
+
+		ctx := r.Context()
+
+		comment, err := app.store.Comment.GetById(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrorNotFound):
+				app.notFounResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if comment.PostID != getPostFromCtx(r).ID {
+			app.notFounResponse(w, r, repository.ErrorNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromCtx(r *http.Request) *repository.Comment {
+	comment, _ := r.Context().Value(commentCtx).(*repository.Comment)
+	return comment
+}
+
+// hydrateComments fills in the related data that the comment queries leave out.
+func (app *app) hydrateComments(ctx context.Context, comments []repository.Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+
+	mentions, err := app.store.Mentions.GetByCommentIds(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range comments {
+		comments[i].Entities.Mentions = mentionsOrEmpty(mentions[comments[i].ID])
+		comments[i].Entities.Hashtags = hashtagEntities(comments[i].Content)
+	}
+
+	return nil
+}
+
+func mentionsOrEmpty(mentions []repository.Mention) []repository.Mention {
+	if mentions == nil {
+		return []repository.Mention{}
+	}
+
+	return mentions
+}
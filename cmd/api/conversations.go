@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/carlosEA28/Social/internal/stream"
+	"github.com/go-chi/chi/v5"
+)
+
+type conversationKey string
+
+const conversationCtx conversationKey = "conversation"
+
+const (
+	streamMessageCreated = "message.created"
+	streamMessageRead    = "message.read"
+)
+
+var (
+	errSelfConversation = errors.New("user_ids must not include yourself")
+	errCannotMessage    = errors.New("you can't message this user")
+)
+
+type CreateConversationPayload struct {
+	// UserIDs lists the other members, one for a one-to-one conversation and up
+	// to nine for a group.
+	UserIDs []int64 `json:"user_ids" validate:"required,min=1,max=9,unique,dive,gt=0"`
+	Content string  `json:"content" validate:"omitempty,max=2000"`
+}
+
+type CreateMessagePayload struct {
+	Content string `json:"content" validate:"required,max=2000"`
+}
+
+type MarkConversationReadPayload struct {
+	// MessageID is the last message read, the latest one when left out.
+	MessageID int64 `json:"message_id" validate:"gte=0"`
+}
+
+// getConversationsHandler lists the caller's conversations, the most recently
+// active first, with their latest message and unread count.
+func (app *app) getConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := app.parseUnfilteredPagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	conversations, err := app.store.Conversations.GetByUser(r.Context(), getUserFromContext(r).ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var next *repository.Cursor
+	if n := len(conversations); n > 0 {
+		next = nextCursor(fq, n, conversations[n-1].UpdatedAt, conversations[n-1].ID)
+	}
+
+	if err := app.paginatedResponse(w, r, conversations, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createConversationHandler starts a conversation with the users in the body,
+// optionally with a first message. Starting a one-to-one conversation again
+// returns the existing one. Every member must be reachable by the caller: active,
+// not blocked either way and, if they only take messages from the accounts they
+// follow, following the caller.
+func (app *app) createConversationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateConversationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	if slices.Contains(payload.UserIDs, user.ID) {
+		app.badRequetResponse(w, r, errSelfConversation)
+		return
+	}
+
+	unreachable, err := app.store.Conversations.GetUnreachable(ctx, user.ID, payload.UserIDs)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if len(unreachable) > 0 {
+		app.badRequetResponse(w, r, fmt.Errorf("you can't message user %d", unreachable[0]))
+		return
+	}
+
+	id, created, err := app.store.Conversations.Create(ctx, user.ID, payload.UserIDs)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	conversation, err := app.store.Conversations.GetById(ctx, id, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if payload.Content != "" {
+		message, err := app.sendMessage(ctx, conversation, user, payload.Content)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		conversation.LastMessage = message
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	if err := app.jsonResponse(w, status, conversation); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *app) getConversationHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusOK, getConversationFromCtx(r)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getMessagesHandler lists the messages of a conversation, newest first unless
+// ?sort=asc.
+func (app *app) getMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := app.parseUnfilteredPagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	messages, err := app.store.Conversations.GetMessages(r.Context(), getConversationFromCtx(r).ID, getUserFromContext(r).ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var next *repository.Cursor
+	if n := len(messages); n > 0 {
+		next = nextCursor(fq, n, messages[n-1].CreatedAt, messages[n-1].ID)
+	}
+
+	if err := app.paginatedResponse(w, r, messages, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createMessageHandler sends a message to a conversation. In a one-to-one
+// conversation the other member must still be reachable by the caller.
+func (app *app) createMessageHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateMessagePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+	conversation := getConversationFromCtx(r)
+
+	if !conversation.IsGroup {
+		unreachable, err := app.store.Conversations.GetUnreachable(ctx, user.ID, otherMembers(conversation, user.ID))
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if len(unreachable) > 0 {
+			app.badRequetResponse(w, r, errCannotMessage)
+			return
+		}
+	}
+
+	message, err := app.sendMessage(ctx, conversation, user, payload.Content)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, message); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// markConversationReadHandler moves the caller's read receipt up to a message,
+// the other members are told over their streams.
+func (app *app) markConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MarkConversationReadPayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+	conversation := getConversationFromCtx(r)
+
+	lastRead, err := app.store.Conversations.MarkRead(ctx, conversation.ID, user.ID, payload.MessageID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if lastRead != 0 {
+		app.publishToMembers(ctx, conversation, user.ID, streamMessageRead, map[string]any{
+			"conversation_id": conversation.ID,
+			"user_id":         user.ID,
+			"message_id":      lastRead,
+		})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendMessage adds a message from user to conversation and pushes it to the
+// streams of the other members.
+func (app *app) sendMessage(ctx context.Context, conversation *repository.Conversation, user *repository.User, content string) (*repository.Message, error) {
+	message := &repository.Message{
+		ConversationID: conversation.ID,
+		UserID:         user.ID,
+		Content:        content,
+		User:           repository.User{ID: user.ID, Username: user.Username},
+	}
+
+	if err := app.store.Conversations.CreateMessage(ctx, message); err != nil {
+		return nil, err
+	}
+
+	app.publishToMembers(ctx, conversation, user.ID, streamMessageCreated, message)
+	return message, nil
+}
+
+// publishToMembers publishes an event of eventType to the streams of the
+// members of conversation other than actorId, skipping those blocked either way
+// with the actor. Failing to is only logged, the members still find the change
+// when they next load the conversation.
+func (app *app) publishToMembers(ctx context.Context, conversation *repository.Conversation, actorId int64, eventType string, data any) {
+	blocked, err := app.store.Blocks.GetBlockedIds(ctx, actorId)
+	if err != nil {
+		app.logger.Warnw("error publishing conversation event", "conversation_id", conversation.ID, "event", eventType, "error", err)
+		return
+	}
+
+	for _, memberId := range otherMembers(conversation, actorId) {
+		if slices.Contains(blocked, memberId) {
+			continue
+		}
+
+		if err := app.publishStreamEvent(ctx, stream.UserTopic(memberId), eventType, actorId, data); err != nil {
+			app.logger.Warnw("error publishing conversation event", "conversation_id", conversation.ID, "event", eventType, "error", err)
+		}
+	}
+}
+
+func otherMembers(conversation *repository.Conversation, userId int64) []int64 {
+	var ids []int64
+	for _, m := range conversation.Members {
+		if m.UserID != userId {
+			ids = append(ids, m.UserID)
+		}
+	}
+
+	return ids
+}
+
+// conversationContextMiddleware loads the conversation named by the
+// conversationId URL param, conversations the caller isn't a member of are not found.
+func (app *app) conversationContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "conversationId"), 10, 64)
+		if err != nil {
+			app.badRequetResponse(w, r, errors.New("invalid conversation ID"))
+			return
+		}
+
+		ctx := r.Context()
+
+		conversation, err := app.store.Conversations.GetById(ctx, id, getUserFromContext(r).ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrorNotFound):
+				app.notFounResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, conversationCtx, conversation)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getConversationFromCtx(r *http.Request) *repository.Conversation {
+	conversation, _ := r.Context().Value(conversationCtx).(*repository.Conversation)
+	return conversation
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/carlosEA28/Social/internal/repository"
+)
+
+func (app *app) getDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := app.parsePagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	drafts, err := app.store.Posts.GetDrafts(r.Context(), user.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	posts := make([]*repository.Post, len(drafts))
+	for i := range drafts {
+		posts[i] = &drafts[i]
+	}
+
+	if err := app.hydratePosts(r.Context(), posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var next *repository.Cursor
+	if n := len(drafts); n > 0 {
+		next = nextCursor(fq, n, drafts[n-1].CreatedAt, drafts[n-1].ID)
+	}
+
+	if err := app.paginatedResponse(w, r, drafts, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
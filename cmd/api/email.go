@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/mail"
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// digestIntervals is how often the digest of each mode goes out.
+var digestIntervals = map[string]time.Duration{
+	repository.EmailDaily:  time.Hour * 24,
+	repository.EmailWeekly: time.Hour * 24 * 7,
+}
+
+// digestTopPosts is how many posts of followed accounts a digest features.
+const digestTopPosts = 5
+
+var emailPreferencesRule = fmt.Sprintf("required,dive,keys,oneof=%s,endkeys,oneof=%s %s %s %s",
+	strings.Join(repository.NotificationKinds, " "),
+	repository.EmailImmediate, repository.EmailDaily, repository.EmailWeekly, repository.EmailOff,
+)
+
+// unsubscribeToken is signed into unsubscribe links, an empty Kind stops every
+// notification email.
+type unsubscribeToken struct {
+	UserID int64  `json:"user_id"`
+	Kind   string `json:"kind,omitempty"`
+}
+
+// getEmailPreferencesHandler returns how each kind of notification is mailed to
+// the caller: immediate, daily, weekly or off.
+func (app *app) getEmailPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	prefs, err := app.store.EmailPreferences.Get(r.Context(), getUserFromContext(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// updateEmailPreferencesHandler changes the mode of the kinds in the body, as
+// in {"reaction": "weekly"}, and leaves the others as they were.
+func (app *app) updateEmailPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload map[string]string
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Var(payload, emailPreferencesRule); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	if err := app.store.EmailPreferences.Set(ctx, user.ID, payload); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	prefs, err := app.store.EmailPreferences.Get(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// unsubscribeHandler turns off the emails named by the signed token of an
+// unsubscribe link, it needs no login so the link works in one click.
+func (app *app) unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	var token unsubscribeToken
+	if err := app.unsubscribes.Verify(chi.URLParam(r, "token"), &token); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if _, err := app.store.Users.GetUserById(ctx, token.UserID); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.badRequetResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	kinds := repository.NotificationKinds
+	if token.Kind != "" {
+		kinds = []string{token.Kind}
+	}
+
+	prefs := make(map[string]string, len(kinds))
+	for _, kind := range kinds {
+		prefs[kind] = repository.EmailOff
+	}
+
+	if err := app.store.EmailPreferences.Set(ctx, token.UserID, prefs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendNotificationEmails mails the notifications whose recipients want them as
+// they happen, a batch at a time until none is left. It runs apart from the event
+// workers so that slow mail doesn't hold up notifications, streams and webhooks.
+func (app *app) sendNotificationEmails(ctx context.Context) error {
+	batchSize := app.config.scheduler.batchSize
+
+	for {
+		claimed, err := app.store.Notifications.ClaimEmails(ctx, batchSize, app.config.mail.throttle)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range claimed {
+			if err := app.emailNotification(ctx, e); err != nil {
+				app.logger.Errorw("error sending notification email", "notification_id", e.ID, "error", err)
+			}
+		}
+
+		if len(claimed) < batchSize {
+			return nil
+		}
+	}
+}
+
+// emailNotification mails the claimed notification e to its recipient.
+func (app *app) emailNotification(ctx context.Context, e repository.NotificationEmail) error {
+	user, err := app.store.Users.GetUserById(ctx, e.UserID)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	// every actor may have been blocked or deactivated since
+	n, err := app.store.Notifications.GetById(ctx, user.ID, e.ID)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	url := fmt.Sprintf("%s/users/%d", app.config.frontendURL, n.Actors[0].ID)
+	if n.PostID != nil {
+		url = fmt.Sprintf("%s/posts/%d", app.config.frontendURL, *n.PostID)
+	}
+
+	unsubscribeURL, err := app.unsubscribeURL(user.ID, n.Kind)
+	if err != nil {
+		return err
+	}
+
+	vars := struct {
+		Username       string
+		Summary        string
+		URL            string
+		UnsubscribeURL string
+	}{
+		Username:       user.Username,
+		Summary:        notificationSummary(*n),
+		URL:            url,
+		UnsubscribeURL: unsubscribeURL,
+	}
+
+	_, err = app.mail.Send(mail.NotificationTemplate, user.Username, user.Email, vars, app.config.env != "production")
+	return err
+}
+
+// sendEmailDigests mails the daily and weekly digests that are due, a batch at a
+// time until none is left. A user whose digest fails is retried on the next run.
+func (app *app) sendEmailDigests(ctx context.Context) error {
+	batchSize := app.config.scheduler.batchSize
+
+	for mode, interval := range digestIntervals {
+		var failed []repository.DigestRecipient
+
+		for {
+			recipients, err := app.store.EmailPreferences.ClaimDigestRecipients(ctx, mode, interval, batchSize)
+			if err != nil {
+				return err
+			}
+
+			for _, r := range recipients {
+				if err := app.sendDigest(ctx, r.UserID, mode, interval); err != nil {
+					app.logger.Errorw("error sending email digest", "user_id", r.UserID, "digest", mode, "error", err)
+					failed = append(failed, r)
+				}
+			}
+
+			if len(recipients) < batchSize {
+				break
+			}
+		}
+
+		// released once the run is over so that this run doesn't claim them again
+		for _, r := range failed {
+			if err := app.store.EmailPreferences.ReleaseDigest(ctx, r, mode); err != nil {
+				app.logger.Errorw("error releasing email digest", "user_id", r.UserID, "digest", mode, "error", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sendDigest mails userId the unread notifications waiting for the digest of
+// mode along with the most popular posts of the accounts they follow over the
+// last interval.
+func (app *app) sendDigest(ctx context.Context, userId int64, mode string, interval time.Duration) error {
+	user, err := app.store.Users.GetUserById(ctx, userId)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	notifications, err := app.store.Notifications.GetForDigest(ctx, user.ID, mode, app.config.mail.digestSize)
+	if err != nil {
+		return err
+	}
+
+	// every actor left may have been blocked or deactivated since
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	unread, err := app.store.Notifications.CountUnread(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	topIds, err := app.store.Posts.GetTopFollowed(ctx, user.ID, time.Now().Add(-interval), digestTopPosts)
+	if err != nil {
+		return err
+	}
+
+	top, err := app.store.Posts.GetFeedByIds(ctx, topIds, user.ID)
+	if err != nil {
+		return err
+	}
+
+	unsubscribeURL, err := app.unsubscribeURL(user.ID, "")
+	if err != nil {
+		return err
+	}
+
+	type digestNotification struct {
+		Summary string
+	}
+
+	type digestPost struct {
+		Title    string
+		Username string
+		Comments int
+		URL      string
+	}
+
+	vars := struct {
+		Username         string
+		Frequency        string
+		UnreadCount      int
+		Notifications    []digestNotification
+		NotificationsURL string
+		Posts            []digestPost
+		UnsubscribeURL   string
+	}{
+		Username:         user.Username,
+		Frequency:        mode,
+		NotificationsURL: app.config.frontendURL + "/notifications",
+		UnsubscribeURL:   unsubscribeURL,
+	}
+
+	for _, count := range unread {
+		vars.UnreadCount += count
+	}
+
+	ids := make([]int64, len(notifications))
+	for i, n := range notifications {
+		ids[i] = n.ID
+		vars.Notifications = append(vars.Notifications, digestNotification{Summary: notificationSummary(n)})
+	}
+
+	for _, post := range top {
+		vars.Posts = append(vars.Posts, digestPost{
+			Title:    post.Title,
+			Username: post.User.Username,
+			Comments: post.CommentCount,
+			URL:      fmt.Sprintf("%s/posts/%d", app.config.frontendURL, post.ID),
+		})
+	}
+
+	if _, err := app.mail.Send(mail.DigestTemplate, user.Username, user.Email, vars, app.config.env != "production"); err != nil {
+		return err
+	}
+
+	// the digest is out, failing it now would have it sent twice
+	if err := app.store.Notifications.MarkEmailed(ctx, user.ID, ids); err != nil {
+		app.logger.Errorw("error marking notifications emailed", "user_id", user.ID, "error", err)
+	}
+
+	return nil
+}
+
+// unsubscribeURL links to the frontend page that unsubscribes userId from the
+// emails of kind, or from all of them when kind is empty.
+func (app *app) unsubscribeURL(userId int64, kind string) (string, error) {
+	token, err := app.unsubscribes.Sign(unsubscribeToken{UserID: userId, Kind: kind})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/unsubscribe/%s", app.config.frontendURL, token), nil
+}
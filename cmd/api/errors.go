@@ -34,6 +34,13 @@ func (app *app) notFounResponse(w http.ResponseWriter, r *http.Request, err erro
 
 }
 
+func (app *app) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("conflict", "method", r.Method, "path", r.URL.Path, "error", err)
+
+	writeJSONError(w, http.StatusConflict, err.Error())
+
+}
+
 func (app *app) unauthorizedErrorReposnse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Errorw("Internal error", "method:%s", "path:%s", "error", r.Method, r.URL.Path, err)
 
@@ -1,38 +1,110 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/carlosEA28/Social/internal/ranking"
 	"github.com/carlosEA28/Social/internal/repository"
 )
 
-func (app *app) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
+var errInvalidFeedMode = errors.New("mode must be chronological or ranked")
 
-	fq := repository.PaginatedFeedQuery{
-		Limit:  20,
-		Offset: 0,
-		Sort:   "desc",
-	}
+func (app *app) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
 
-	fq, err := fq.Parse(r)
+	fq, err := app.parsePagination(r)
 	if err != nil {
 		app.badRequetResponse(w, r, err)
 		return
 	}
 
-	if err := Validate.Struct(fq); err != nil {
-		app.badRequetResponse(w, r, err)
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	var feed []repository.PostWithMetadata
+	var next *repository.Cursor
+
+	switch r.URL.Query().Get("mode") {
+	case "", "chronological":
+		// the materialized timeline only keeps the newest first order, filtered and
+		// ascending listings are computed from the follow graph instead
+		if fq.Sort == "desc" && fq.Offset == 0 && !fq.Filtered() {
+			feed, next, err = app.homeTimeline(ctx, user.ID, fq)
+		} else {
+			feed, err = app.store.Posts.GetUserFeed(ctx, user.ID, fq)
+			if n := len(feed); err == nil && n > 0 {
+				next = nextCursor(fq, n, feed[n-1].CreatedAt, feed[n-1].ID)
+			}
+		}
+	case "ranked":
+		feed, next, err = app.rankedFeed(ctx, user.ID, fq)
+	default:
+		app.badRequetResponse(w, r, errInvalidFeedMode)
 		return
 	}
 
-	ctx := r.Context()
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(1), fq)
-
 	if err != nil {
 		app.internalServerError(w, r, err)
+		return
+	}
+
+	posts := make([]*repository.Post, len(feed))
+	for i := range feed {
+		posts[i] = &feed[i].Post
+	}
+
+	if err := app.hydratePosts(ctx, posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+	if err := app.paginatedResponse(w, r, feed, next); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
+
+// rankedFeed scores the recent posts around userId with app.scorer and returns
+// the requested page. Scores move as time passes, so the cursor of a ranked feed
+// pins the instant the first page was ranked at in At and counts the posts
+// already served in ID, and later pages are ranked as of that same instant.
+func (app *app) rankedFeed(ctx context.Context, userId int64, fq repository.PaginatedFeedQuery) ([]repository.PostWithMetadata, *repository.Cursor, error) {
+	now := time.Now()
+	position := fq.Offset
+	if fq.Cursor != nil {
+		now = fq.Cursor.At
+		position = int(fq.Cursor.ID)
+	}
+
+	candidates, err := app.store.Posts.GetRankingCandidates(ctx, userId, fq, now.Add(-app.config.feed.window), now, app.config.feed.candidates)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ranked := ranking.Rank(app.scorer, candidates, now)
+
+	start := min(position, len(ranked))
+	end := min(position+fq.Limit, len(ranked))
+
+	var next *repository.Cursor
+	if end < len(ranked) {
+		next = &repository.Cursor{At: now, ID: int64(end)}
+	}
+
+	if start == end {
+		return []repository.PostWithMetadata{}, next, nil
+	}
+
+	ids := make([]int64, 0, end-start)
+	for _, c := range ranked[start:end] {
+		ids = append(ids, c.PostID)
+	}
+
+	feed, err := app.store.Posts.GetFeedByIds(ctx, ids, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return feed, next, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/carlosEA28/Social/internal/events"
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+func (app *app) getIncomingFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	app.followRequestsResponse(w, r, app.store.FollowRequests.GetIncoming)
+}
+
+func (app *app) getOutgoingFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	app.followRequestsResponse(w, r, app.store.FollowRequests.GetOutgoing)
+}
+
+type followRequestsFunc func(context.Context, int64, repository.PaginatedFeedQuery) ([]repository.FollowRequest, error)
+
+func (app *app) followRequestsResponse(w http.ResponseWriter, r *http.Request, list followRequestsFunc) {
+	fq, err := app.parseUnfilteredPagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	requests, err := list(r.Context(), getUserFromContext(r).ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var next *repository.Cursor
+	if n := len(requests); n > 0 {
+		next = nextCursor(fq, n, requests[n-1].CreatedAt, requests[n-1].User.ID)
+	}
+
+	if err := app.paginatedResponse(w, r, requests, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// approveFollowRequestHandler lets the user in the URL follow the caller.
+func (app *app) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	requesterId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequetResponse(w, r, errors.New("invalid user ID"))
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	if err := app.store.FollowRequests.Approve(ctx, requesterId, user.ID); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.enqueueBackfill(ctx, requesterId, user.ID)
+	app.events.Publish(ctx, events.Event{Type: events.UserFollowed, ActorID: requesterId, UserID: user.ID})
+
+	app.relationshipResponse(w, r, requesterId)
+}
+
+// rejectFollowRequestHandler turns down the request of the user in the URL to follow the caller.
+func (app *app) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	requesterId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequetResponse(w, r, errors.New("invalid user ID"))
+		return
+	}
+
+	deleted, err := app.store.FollowRequests.Delete(r.Context(), requesterId, getUserFromContext(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !deleted {
+		app.notFounResponse(w, r, repository.ErrorNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
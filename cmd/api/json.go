@@ -2,8 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
+	"github.com/carlosEA28/Social/internal/repository"
+
 	"github.com/go-playground/validator/v10"
 )
 
@@ -46,3 +49,42 @@ func (app *app) jsonResponse(w http.ResponseWriter, status int, data any) error
 
 	return writeJSON(w, status, &envelope{Data: data})
 }
+
+// paginatedResponse writes a page of a list along with the cursor of the next one,
+// which is also advertised in an RFC 8288 Link header.
+func (app *app) paginatedResponse(w http.ResponseWriter, r *http.Request, data any, next *repository.Cursor) error {
+	type envelope struct {
+		Data       any     `json:"data"`
+		NextCursor *string `json:"next_cursor"`
+	}
+
+	token, err := app.nextPageLink(w, r, next)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, http.StatusOK, envelope{Data: data, NextCursor: token})
+}
+
+// nextPageLink signs next for the listing r reads and sets the Link header pointing
+// at the page it starts, it returns nil when there is no next page.
+func (app *app) nextPageLink(w http.ResponseWriter, r *http.Request, next *repository.Cursor) (*string, error) {
+	if next == nil {
+		return nil, nil
+	}
+
+	token, err := app.cursors.Sign(signedCursor{Cursor: *next, Scope: cursorScope(r)})
+	if err != nil {
+		return nil, err
+	}
+
+	link := *r.URL
+	qs := link.Query()
+	qs.Set("cursor", token)
+	qs.Del("offset")
+	link.RawQuery = qs.Encode()
+
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, link.String()))
+
+	return &token, nil
+}
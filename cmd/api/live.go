@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/carlosEA28/Social/internal/stream"
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+)
+
+const (
+	liveWriteWait  = time.Second * 10
+	livePongWait   = time.Second * 60
+	livePingPeriod = livePongWait * 9 / 10
+	liveMaxMessage = 4096
+	// liveBuffer is how many events a connection can fall behind before it is closed.
+	liveBuffer = 64
+
+	// clients may send liveRate messages per second with bursts of liveBurst, a
+	// connection that keeps going over the limit liveMaxViolations times is closed
+	liveRate          = 2
+	liveBurst         = 10
+	liveMaxViolations = 5
+
+	// liveTypingInterval throttles how often a viewer's typing is broadcast.
+	liveTypingInterval = time.Second * 3
+
+	liveTyping = "comment.typing"
+	liveError  = "error"
+)
+
+var errLiveNotPublished = errors.New("live threads are only available on published posts")
+
+var liveUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// clients authenticate with a bearer token rather than cookies, so like the
+	// CORS policy any origin may connect
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// liveMessage is what goes over the socket both ways, clients only send typing.
+type liveMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// liveCommentsHandler upgrades to a WebSocket broadcasting the comments created,
+// edited and deleted under the post, and who is typing one, to everyone viewing it.
+func (app *app) liveCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+
+	if !post.IsPublished() {
+		app.badRequetResponse(w, r, errLiveNotPublished)
+		return
+	}
+
+	blockedIds, err := app.store.Blocks.GetBlockedIds(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	blocked := make(map[int64]bool, len(blockedIds))
+	for _, id := range blockedIds {
+		blocked[id] = true
+	}
+
+	// Upgrade writes the error response itself
+	conn, err := liveUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sub := app.hub.Subscribe([]string{stream.PostTopic(post.ID)}, liveBuffer)
+	defer sub.Close()
+
+	// the request context doesn't follow a hijacked connection, the reader ends
+	// this one when the client goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	replies := make(chan liveMessage, liveBurst)
+	go app.readLive(ctx, cancel, conn, user, post, replies)
+
+	ping := time.NewTicker(livePingPeriod)
+	defer ping.Stop()
+
+	for {
+		var msg liveMessage
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Done():
+			closeLive(conn, websocket.CloseTryAgainLater, "too far behind")
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait)); err != nil {
+				return
+			}
+			continue
+		case msg = <-replies:
+		case e := <-sub.C:
+			if blocked[e.ActorID] || (e.Type == liveTyping && e.ActorID == user.ID) {
+				continue
+			}
+			msg = liveMessage{Type: e.Type, Data: e.Data}
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+		if err := conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// readLive handles what the client sends until it disconnects or is closed for
+// going over the rate limit, replies go through the writer in liveCommentsHandler.
+func (app *app) readLive(ctx context.Context, cancel context.CancelFunc, conn *websocket.Conn, user *repository.User, post *repository.Post, replies chan<- liveMessage) {
+	defer cancel()
+
+	conn.SetReadLimit(liveMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(livePongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(livePongWait))
+	})
+
+	limiter := rate.NewLimiter(liveRate, liveBurst)
+	violations := 0
+
+	var lastTyping time.Time
+
+	for {
+		var msg liveMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				closeLive(conn, websocket.CloseUnsupportedData, "messages must be JSON")
+			}
+			return
+		}
+
+		if !limiter.Allow() {
+			violations++
+			if violations >= liveMaxViolations {
+				closeLive(conn, websocket.ClosePolicyViolation, "rate limit exceeded")
+				return
+			}
+
+			reply(replies, liveError, "rate limit exceeded, slow down")
+			continue
+		}
+
+		switch msg.Type {
+		case "typing":
+			if time.Since(lastTyping) < liveTypingInterval {
+				continue
+			}
+			lastTyping = time.Now()
+
+			data, _ := json.Marshal(map[string]any{"user_id": user.ID, "username": user.Username})
+
+			err := app.store.Stream.Notify(ctx, stream.Event{
+				Topic:   stream.PostTopic(post.ID),
+				Type:    liveTyping,
+				ActorID: user.ID,
+				Data:    data,
+			})
+			if err != nil {
+				app.logger.Warnw("live typing notify failed", "post_id", post.ID, "error", err)
+			}
+		default:
+			reply(replies, liveError, "unknown message type")
+		}
+	}
+}
+
+// reply queues an error for the client, dropping it when the client isn't
+// keeping up with the ones already queued.
+func reply(replies chan<- liveMessage, msgType, message string) {
+	data, _ := json.Marshal(map[string]string{"error": message})
+
+	select {
+	case replies <- liveMessage{Type: msgType, Data: data}:
+	default:
+	}
+}
+
+func closeLive(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(liveWriteWait))
+}
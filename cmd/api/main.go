@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
 	"log"
 	"time"
 
 	"github.com/carlosEA28/Social/internal/auth"
 	"github.com/carlosEA28/Social/internal/db"
 	"github.com/carlosEA28/Social/internal/env"
+	"github.com/carlosEA28/Social/internal/events"
 	"github.com/carlosEA28/Social/internal/mail"
+	"github.com/carlosEA28/Social/internal/ranking"
 	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/carlosEA28/Social/internal/repository/cache"
+	"github.com/carlosEA28/Social/internal/signer"
+	"github.com/carlosEA28/Social/internal/storage"
+	"github.com/carlosEA28/Social/internal/stream"
+	"github.com/carlosEA28/Social/internal/webhook"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
@@ -33,7 +41,10 @@ func main() {
 		},
 		env: env.GetString("ENV", "development"),
 		mail: mailConfig{
-			exp: time.Hour * 24 * 3, // 3 days
+			exp:        time.Hour * 24 * 3, // 3 days
+			throttle:   time.Hour,
+			interval:   time.Second * 30,
+			digestSize: 20,
 			mailtrap: mailtrapConfig{
 				apiKey:    env.GetString("MAILTRAP_API_KEY", ""),
 				fromEmail: env.GetString("FROM_ADDRESS", ""),
@@ -46,6 +57,53 @@ func main() {
 				issuer:  "gophersocial",
 			},
 		},
+		scheduler: schedulerConfig{
+			interval:       time.Minute,
+			batchSize:      env.GetInt("SCHEDULER_BATCH_SIZE", 100),
+			trashRetention: time.Hour * 24 * 30, // 30 days
+		},
+		storage: storageConfig{
+			dir:            env.GetString("STORAGE_DIR", "./uploads"),
+			maxUploadBytes: int64(env.GetInt("MAX_UPLOAD_BYTES", 10<<20)), // 10mb
+			maxPerPost:     4,
+			thumbnailSize:  320,
+		},
+		redisCfg: redisConfig{
+			addr:    env.GetString("REDIS_ADDR", "localhost:6379"),
+			pw:      env.GetString("REDIS_PW", ""),
+			db:      env.GetInt("REDIS_DB", 0),
+			enabled: env.GetBool("REDIS_ENABLED", false),
+		},
+		timeline: timelineConfig{
+			celebrityThreshold: int64(env.GetInt("TIMELINE_CELEBRITY_THRESHOLD", 10000)),
+			workers:            env.GetInt("TIMELINE_WORKERS", 4),
+			interval:           time.Second,
+			lease:              time.Minute * 5,
+			backfillSize:       50,
+		},
+		feed: feedConfig{
+			ranking:    env.GetString("FEED_RANKING", "engagement"),
+			window:     time.Hour * 24 * 3, // 3 days
+			candidates: 500,
+		},
+		events: eventsConfig{
+			workers:   env.GetInt("EVENT_WORKERS", 4),
+			queueSize: 1000,
+		},
+		stream: streamConfig{
+			heartbeat: time.Second * 15,
+			retention: time.Hour * 24,
+		},
+		webhooks: webhooksConfig{
+			interval:     time.Second * 5,
+			workers:      env.GetInt("WEBHOOK_WORKERS", 4),
+			timeout:      time.Second * 10,
+			maxAttempts:  8,
+			backoff:      time.Second * 30,
+			disableAfter: 20,
+			retention:    time.Hour * 24 * 30, // 30 days
+			allowPrivate: env.GetBool("WEBHOOKS_ALLOW_PRIVATE", false),
+		},
 	}
 
 	//logger
@@ -64,11 +122,31 @@ func main() {
 
 	store := repository.NewPostgresStorage(db)
 
+	//cache
+	var cacheStorage cache.Storage
+	if cfg.redisCfg.enabled {
+		rdb := cache.NewRedisClient(cfg.redisCfg.addr, cfg.redisCfg.pw, cfg.redisCfg.db)
+		defer rdb.Close()
+		logger.Info("redis cache connection established")
+
+		cacheStorage = cache.NewRedisStorage(rdb)
+	}
+
 	mailClient, err := mail.NewMailTrapClient(cfg.mail.mailtrap.apiKey, cfg.mail.mailtrap.fromEmail)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	blobs, err := storage.NewLocalStorage(cfg.storage.dir)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	scorer, ok := ranking.ByName(cfg.feed.ranking)
+	if !ok {
+		logger.Fatalf("unknown feed ranking %q", cfg.feed.ranking)
+	}
+
 	JwtAuthenticator := auth.NewJWTAuthenticator(cfg.auth.token.secret, cfg.auth.token.issuer, cfg.auth.token.issuer)
 
 	app := &app{
@@ -77,8 +155,26 @@ func main() {
 		logger:        logger,
 		mail:          mailClient,
 		authenticator: JwtAuthenticator,
+		blobs:         blobs,
+		cursors:       signer.New(cfg.auth.token.secret, "pagination-cursor"),
+		cacheStorage:  cacheStorage,
+		scorer:        scorer,
+		events: events.NewBus(cfg.events.queueSize, func(e events.Event, subscriber string, err error) {
+			logger.Errorw("event handler failed", "event", e.Type, "subscriber", subscriber, "error", err)
+		}, func(e events.Event, dropped int64) {
+			logger.Errorw("event queue full, event dropped", "event", e.Type, "actor_id", e.ActorID, "dropped", dropped)
+		}),
+		hub:           stream.NewHub(),
+		unsubscribes:  signer.New(cfg.auth.token.secret, "email-unsubscribe"),
+		streamTickets: signer.New(cfg.auth.token.secret, "stream-ticket"),
+		webhooks:      webhook.NewClient(cfg.webhooks.timeout, cfg.webhooks.allowPrivate),
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	app.startBackgroundJobs(ctx)
+
 	mux := app.mount()
 	logger.Fatal(app.run(mux))
 
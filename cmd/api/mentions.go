@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/carlosEA28/Social/internal/repository"
+)
+
+func (app *app) getMentionsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := app.parsePagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	mentions, err := app.store.Posts.GetMentioning(ctx, user.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	posts := make([]*repository.Post, len(mentions))
+	for i := range mentions {
+		posts[i] = &mentions[i].Post
+	}
+
+	if err := app.hydratePosts(ctx, posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var next *repository.Cursor
+	if n := len(mentions); n > 0 {
+		next = nextCursor(fq, n, mentions[n-1].CreatedAt, mentions[n-1].ID)
+	}
+
+	if err := app.paginatedResponse(w, r, mentions, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
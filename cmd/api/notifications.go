@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/carlosEA28/Social/internal/events"
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/carlosEA28/Social/internal/stream"
+	"github.com/go-chi/chi/v5"
+)
+
+// getNotificationsHandler lists the caller's notifications, only the unread ones
+// with ?unread=true, along with how many are unread.
+func (app *app) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := app.parseUnfilteredPagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	var unreadOnly bool
+	if raw := r.URL.Query().Get("unread"); raw != "" {
+		unreadOnly, err = strconv.ParseBool(raw)
+		if err != nil {
+			app.badRequetResponse(w, r, fmt.Errorf("invalid unread %q", raw))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	notifications, err := app.store.Notifications.Get(ctx, user.ID, unreadOnly, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	unread, err := app.store.Notifications.CountUnread(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	for i := range notifications {
+		notifications[i].Summary = notificationSummary(notifications[i])
+	}
+
+	var next *repository.Cursor
+	if n := len(notifications); n > 0 {
+		next = nextCursor(fq, n, notifications[n-1].UpdatedAt, notifications[n-1].ID)
+	}
+
+	token, err := app.nextPageLink(w, r, next)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	type envelope struct {
+		Data         []repository.Notification `json:"data"`
+		NextCursor   *string                   `json:"next_cursor"`
+		UnreadCount  int                       `json:"unread_count"`
+		UnreadByKind map[string]int            `json:"unread_by_kind"`
+	}
+
+	env := envelope{Data: notifications, NextCursor: token, UnreadByKind: unread}
+	for _, count := range unread {
+		env.UnreadCount += count
+	}
+
+	if err := writeJSON(w, http.StatusOK, env); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *app) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "notificationId"), 10, 64)
+	if err != nil {
+		app.badRequetResponse(w, r, errors.New("invalid notification ID"))
+		return
+	}
+
+	if err := app.store.Notifications.MarkRead(r.Context(), getUserFromContext(r).ID, id); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *app) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := app.store.Notifications.MarkAllRead(r.Context(), getUserFromContext(r).ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recordNotifications turns events into the notifications of the users they
+// concern. Nobody is notified of their own actions, nor about posts they can't
+// see, and each user hears about a comment at most once: as mentioned in it,
+// replied to or as the author of the post, in that order.
+func (app *app) recordNotifications(ctx context.Context, e events.Event) error {
+	switch e.Type {
+	case events.UserFollowed:
+		return app.notify(ctx, e, repository.NewNotification{
+			UserID:   e.UserID,
+			Kind:     repository.NotificationFollow,
+			GroupKey: repository.NotificationFollow,
+		})
+
+	case events.PostReacted:
+		post, err := app.store.Posts.GetById(ctx, e.PostID)
+		if err != nil {
+			return ignoreNotFound(err)
+		}
+
+		return app.notify(ctx, e, repository.NewNotification{
+			UserID:   post.UserId,
+			Kind:     repository.NotificationReaction,
+			GroupKey: notificationGroup(repository.NotificationReaction, post.ID),
+			PostID:   &post.ID,
+		})
+
+	case events.PostCreated:
+		post, err := app.store.Posts.GetById(ctx, e.PostID)
+		if err != nil {
+			return ignoreNotFound(err)
+		}
+
+		mentions, err := app.store.Mentions.GetByPostIds(ctx, []int64{post.ID})
+		if err != nil {
+			return err
+		}
+
+		notified := map[int64]bool{e.ActorID: true}
+		for _, m := range mentions[post.ID] {
+			err := app.notifyOnce(ctx, e, notified, post, repository.NewNotification{
+				UserID:   m.UserID,
+				Kind:     repository.NotificationMention,
+				GroupKey: notificationGroup(repository.NotificationMention, post.ID),
+				PostID:   &post.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case events.CommentCreated:
+		comment, err := app.store.Comment.GetById(ctx, e.CommentID)
+		if err != nil {
+			return ignoreNotFound(err)
+		}
+
+		post, err := app.store.Posts.GetById(ctx, comment.PostID)
+		if err != nil {
+			return ignoreNotFound(err)
+		}
+
+		mentions, err := app.store.Mentions.GetByCommentIds(ctx, []int64{comment.ID})
+		if err != nil {
+			return err
+		}
+
+		notified := map[int64]bool{e.ActorID: true}
+		for _, m := range mentions[comment.ID] {
+			err := app.notifyOnce(ctx, e, notified, post, repository.NewNotification{
+				UserID:    m.UserID,
+				Kind:      repository.NotificationMention,
+				GroupKey:  notificationGroup(repository.NotificationMention, post.ID),
+				PostID:    &post.ID,
+				CommentID: &comment.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if comment.ParentID != nil {
+			parent, err := app.store.Comment.GetById(ctx, *comment.ParentID)
+			if err != nil {
+				return ignoreNotFound(err)
+			}
+
+			err = app.notifyOnce(ctx, e, notified, post, repository.NewNotification{
+				UserID:    parent.UserID,
+				Kind:      repository.NotificationReply,
+				GroupKey:  notificationGroup(repository.NotificationReply, parent.ID),
+				PostID:    &post.ID,
+				CommentID: &comment.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return app.notifyOnce(ctx, e, notified, post, repository.NewNotification{
+			UserID:    post.UserId,
+			Kind:      repository.NotificationComment,
+			GroupKey:  notificationGroup(repository.NotificationComment, post.ID),
+			PostID:    &post.ID,
+			CommentID: &comment.ID,
+		})
+	}
+
+	return nil
+}
+
+// notifyOnce records n unless its recipient was already notified of the same
+// event or can't see post.
+func (app *app) notifyOnce(ctx context.Context, e events.Event, notified map[int64]bool, post *repository.Post, n repository.NewNotification) error {
+	if notified[n.UserID] {
+		return nil
+	}
+	notified[n.UserID] = true
+
+	visible, err := app.canSeePost(ctx, &repository.User{ID: n.UserID}, post)
+	if err != nil || !visible {
+		return err
+	}
+
+	return app.notify(ctx, e, n)
+}
+
+// notify records n on behalf of the actor of e.
+func (app *app) notify(ctx context.Context, e events.Event, n repository.NewNotification) error {
+	if n.UserID == e.ActorID {
+		return nil
+	}
+
+	n.ActorID = e.ActorID
+
+	id, err := app.store.Notifications.Record(ctx, n)
+	if err != nil || id == 0 {
+		return err
+	}
+
+	return app.publishStreamEvent(ctx, stream.UserTopic(n.UserID), streamNotificationCreated, n.ActorID, map[string]any{
+		"kind":       n.Kind,
+		"actor_id":   n.ActorID,
+		"post_id":    n.PostID,
+		"comment_id": n.CommentID,
+	})
+}
+
+// notificationGroup keys the notifications of kind about the post or comment id,
+// those with the same key are coalesced while unread.
+func notificationGroup(kind string, id int64) string {
+	return fmt.Sprintf("%s:%d", kind, id)
+}
+
+var notificationActions = map[string]string{
+	repository.NotificationFollow:   "started following you",
+	repository.NotificationComment:  "commented on your post",
+	repository.NotificationReply:    "replied to your comment",
+	repository.NotificationMention:  "mentioned you",
+	repository.NotificationReaction: "reacted to your post",
+}
+
+// notificationSummary describes n as in "alice and 4 others reacted to your post".
+func notificationSummary(n repository.Notification) string {
+	names := make([]string, len(n.Actors))
+	for i, a := range n.Actors {
+		names[i] = a.Username
+	}
+
+	return namesAndOthers(names, n.ActorCount) + " " + notificationActions[n.Kind]
+}
+
+func ignoreNotFound(err error) error {
+	if errors.Is(err, repository.ErrorNotFound) {
+		return nil
+	}
+	return err
+}
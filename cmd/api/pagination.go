@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/repository"
+)
+
+var (
+	errInvalidCursor   = errors.New("invalid cursor")
+	errCursorAndOffset = errors.New("cursor and offset can't be used together")
+	errCursorScope     = errors.New("cursor was issued for another listing")
+	errNotFilterable   = errors.New("tags, search, since and until only apply to listings of posts")
+)
+
+// signedCursor is what a cursor token carries: the cursor and the listing it was
+// issued for, since feeds, search and suggestions read Cursor.ID differently.
+type signedCursor struct {
+	repository.Cursor
+	Scope string `json:"scope"`
+}
+
+// cursorScope names the listing r reads: its path, the mode or type it is in and
+// the sort order.
+func cursorScope(r *http.Request) string {
+	qs := r.URL.Query()
+
+	sort := qs.Get("sort")
+	if sort == "" {
+		sort = "desc"
+	}
+
+	return strings.Join([]string{r.URL.Path, qs.Get("mode"), qs.Get("type"), sort}, "|")
+}
+
+// parsePagination reads limit, sort and the opaque cursor (or the legacy offset) of a list request.
+func (app *app) parsePagination(r *http.Request) (repository.PaginatedFeedQuery, error) {
+	fq := repository.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		return fq, err
+	}
+
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		if fq.Offset != 0 {
+			return fq, errCursorAndOffset
+		}
+
+		var cursor signedCursor
+		if err := app.cursors.Verify(raw, &cursor); err != nil {
+			return fq, errInvalidCursor
+		}
+
+		if cursor.Scope != cursorScope(r) {
+			return fq, errCursorScope
+		}
+
+		fq.Cursor = &cursor.Cursor
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		return fq, err
+	}
+
+	return fq, nil
+}
+
+// parseUnfilteredPagination is parsePagination for listings that aren't of posts,
+// which refuse the tags, search and date filters instead of ignoring them.
+func (app *app) parseUnfilteredPagination(r *http.Request) (repository.PaginatedFeedQuery, error) {
+	fq, err := app.parsePagination(r)
+	if err != nil {
+		return fq, err
+	}
+
+	if fq.Filtered() {
+		return fq, errNotFilterable
+	}
+
+	return fq, nil
+}
+
+// nextCursor returns where the page after the one just read starts, or nil when
+// fewer rows than the limit came back and there is nothing left to read.
+func nextCursor(fq repository.PaginatedFeedQuery, count int, at string, id int64) *repository.Cursor {
+	if count < fq.Limit {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return nil
+	}
+
+	return &repository.Cursor{At: t, ID: id}
+}
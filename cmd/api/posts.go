@@ -5,7 +5,10 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/carlosEA28/Social/internal/entities"
+	"github.com/carlosEA28/Social/internal/events"
 	"github.com/carlosEA28/Social/internal/repository"
 	"github.com/go-chi/chi/v5"
 )
@@ -15,16 +18,27 @@ type postKey string
 const postCtx postKey = "post"
 
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,max=100"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags"`
+	Title     string     `json:"title" validate:"required,max=100"`
+	Content   string     `json:"content" validate:"required,max=1000"`
+	Tags      []string   `json:"tags"`
+	Status    string     `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at" validate:"required_if=Status scheduled"`
 }
 
 type UpdatePostPayload struct {
-	Title   *string `json:"title" validate:"omitempty,max=100"`
-	Content *string `json:"content" validate:"omitempty,max=1000"`
+	Title     *string    `json:"title" validate:"omitempty,max=100"`
+	Content   *string    `json:"content" validate:"omitempty,max=1000"`
+	Tags      *[]string  `json:"tags"`
+	Status    *string    `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
+var (
+	errPublishAtInPast    = errors.New("publish_at must be in the future")
+	errPublishAtRequired  = errors.New("publish_at is required for scheduled posts")
+	errPostAlreadyVisible = errors.New("published posts cannot be moved back to drafts")
+)
+
 func (app *app) createPostHandler(w http.ResponseWriter, r *http.Request) {
 	var payload CreatePostPayload
 
@@ -43,8 +57,20 @@ func (app *app) createPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := &repository.Post{
 		Title:   payload.Title,
 		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserId:  user.ID,
+		Tags:    entities.MergeTags(payload.Tags, payload.Content),
+		// merging with no content only normalizes them
+		ExplicitTags: entities.MergeTags(payload.Tags, ""),
+		UserId:       user.ID,
+		Status:       payload.Status,
+	}
+
+	if post.Status == repository.PostStatusScheduled {
+		if !payload.PublishAt.After(time.Now()) {
+			app.badRequetResponse(w, r, errPublishAtInPast)
+			return
+		}
+
+		post.PublishAt = payload.PublishAt
 	}
 
 	ctx := r.Context()
@@ -54,6 +80,12 @@ func (app *app) createPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if post.IsPublished() {
+		app.postPublished(ctx, *post)
+	}
+
+	post.Entities.Hashtags = hashtagEntities(post.Content)
+
 	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -64,15 +96,25 @@ func (app *app) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	post := getPostFromCtx(r) // ver se nao quebrou
 
-	comments, err := app.store.Comment.GetByPostId(r.Context(), post.ID)
+	comments, err := app.store.Comment.GetByPostId(r.Context(), post.ID, getUserFromContext(r).ID)
 
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	if err := app.hydrateComments(r.Context(), comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	post.Comments = comments
 
+	if err := app.hydratePosts(r.Context(), post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -92,9 +134,10 @@ func (app *app) deletePostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
+	user := getUserFromContext(r)
 
 	// Tenta excluir o post
-	err = app.store.Posts.Delete(ctx, id)
+	err = app.store.Posts.Delete(ctx, id, user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, repository.ErrorNotFound):
@@ -122,18 +165,40 @@ func (app *app) updatePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// tags that came from hashtags follow the content, the explicit ones stay unless
+	// replaced. Every tag of a post that normalizeLegacyTags hasn't reached yet is
+	// an explicit one, as it would make them.
+	explicitTags := post.ExplicitTags
+	if explicitTags == nil {
+		explicitTags = post.Tags
+	}
+	if payload.Tags != nil {
+		explicitTags = *payload.Tags
+	}
+	post.ExplicitTags = entities.MergeTags(explicitTags, "")
+
 	if payload.Content != nil {
 		post.Content = *payload.Content
 	}
 
+	post.Tags = entities.MergeTags(explicitTags, post.Content)
+
 	if payload.Title != nil {
 		post.Title = *payload.Title
 	}
 
+	wasPublished := post.IsPublished()
+	if err := applyStatusChange(post, payload.Status, payload.PublishAt); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
 	if err := app.store.Posts.Update(r.Context(), post); err != nil {
 		switch {
 		case errors.Is(err, repository.ErrorNotFound):
 			app.notFounResponse(w, r, err)
+		case errors.Is(err, repository.ErrorEditConflict):
+			app.conflictResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
@@ -141,6 +206,12 @@ func (app *app) updatePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !wasPublished && post.IsPublished() {
+		app.postPublished(r.Context(), *post)
+	}
+
+	post.Entities.Hashtags = hashtagEntities(post.Content)
+
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -172,12 +243,120 @@ func (app *app) postContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		visible, err := app.canSeePost(ctx, getUserFromContext(r), post)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !visible {
+			app.notFounResponse(w, r, repository.ErrorNotFound)
+			return
+		}
+
 		ctx = context.WithValue(ctx, postCtx, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 
 }
 
+// canSeePost reports whether viewer may see post: unpublished posts only exist for
+// their author and the posts of private accounts for their approved followers.
+func (app *app) canSeePost(ctx context.Context, viewer *repository.User, post *repository.Post) (bool, error) {
+	if post.UserId == viewer.ID {
+		return true, nil
+	}
+
+	if !post.IsPublished() {
+		return false, nil
+	}
+
+	return app.store.Users.CanView(ctx, viewer.ID, post.UserId)
+}
+
+// postPublished hands a post that just went public to the timelines and to the
+// event subscribers.
+func (app *app) postPublished(ctx context.Context, post repository.Post) {
+	app.enqueueFanOut(ctx, post)
+	app.events.Publish(ctx, events.Event{Type: events.PostCreated, ActorID: post.UserId, PostID: post.ID})
+}
+
+func applyStatusChange(post *repository.Post, status *string, publishAt *time.Time) error {
+	if status == nil {
+		if publishAt != nil && post.Status == repository.PostStatusScheduled {
+			if !publishAt.After(time.Now()) {
+				return errPublishAtInPast
+			}
+			post.PublishAt = publishAt
+		}
+		return nil
+	}
+
+	if post.IsPublished() && *status != repository.PostStatusPublished {
+		return errPostAlreadyVisible
+	}
+
+	switch *status {
+	case repository.PostStatusScheduled:
+		if publishAt == nil {
+			return errPublishAtRequired
+		}
+		if !publishAt.After(time.Now()) {
+			return errPublishAtInPast
+		}
+		post.PublishAt = publishAt
+	case repository.PostStatusDraft:
+		post.PublishAt = nil
+	}
+
+	post.Status = *status
+	return nil
+}
+
+// hydratePosts fills in the related data that the post queries leave out.
+func (app *app) hydratePosts(ctx context.Context, posts ...*repository.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+
+	attachments, err := app.store.Attachments.GetByPostIds(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	mentions, err := app.store.Mentions.GetByPostIds(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	reactions, err := app.store.Reactions.CountByPostIds(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		post.Attachments = attachments[post.ID]
+		if post.Attachments == nil {
+			post.Attachments = []repository.Attachment{}
+		}
+
+		for i := range post.Attachments {
+			setAttachmentURLs(&post.Attachments[i])
+		}
+
+		post.Reactions = reactionsOrEmpty(reactions[post.ID])
+		post.Entities.Mentions = mentionsOrEmpty(mentions[post.ID])
+		post.Entities.Hashtags = hashtagEntities(post.Content)
+	}
+
+	return nil
+}
+
 func getPostFromCtx(r *http.Request) *repository.Post {
 	post, _ := r.Context().Value(postCtx).(*repository.Post)
 	return post
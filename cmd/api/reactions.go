@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/carlosEA28/Social/internal/events"
+)
+
+type ReactionPayload struct {
+	Kind string `json:"kind" validate:"required,oneof=like love laugh wow sad angry"`
+}
+
+var errReactionNotPublished = errors.New("reactions are only allowed on published posts")
+
+func (app *app) setReactionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	if !post.IsPublished() {
+		app.badRequetResponse(w, r, errReactionNotPublished)
+		return
+	}
+
+	var payload ReactionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	ctx := r.Context()
+
+	created, err := app.store.Reactions.Set(ctx, post.ID, user.ID, payload.Kind)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// changing the kind of a reaction isn't news to anyone
+	if created {
+		app.events.Publish(ctx, events.Event{Type: events.PostReacted, ActorID: user.ID, PostID: post.ID, Kind: payload.Kind})
+	}
+
+	app.reactionsResponse(w, r, post.ID)
+}
+
+func (app *app) removeReactionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+
+	if err := app.store.Reactions.Remove(r.Context(), post.ID, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.reactionsResponse(w, r, post.ID)
+}
+
+// reactionsResponse writes the reaction counts of postId after a change.
+func (app *app) reactionsResponse(w http.ResponseWriter, r *http.Request, postId int64) {
+	counts, err := app.store.Reactions.CountByPostIds(r.Context(), []int64{postId})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, reactionsOrEmpty(counts[postId])); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func reactionsOrEmpty(counts map[string]int) map[string]int {
+	if counts == nil {
+		return map[string]int{}
+	}
+	return counts
+}
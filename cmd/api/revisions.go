@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/carlosEA28/Social/internal/diff"
+	"github.com/carlosEA28/Social/internal/repository"
+)
+
+type RevisionDiff struct {
+	PostID  int64        `json:"post_id"`
+	From    int          `json:"from"`
+	To      int          `json:"to"`
+	Title   []diff.Chunk `json:"title"`
+	Content []diff.Chunk `json:"content"`
+}
+
+func (app *app) getPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	revisions, err := app.store.Revisions.GetByPostId(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revisions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *app) getPostRevisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	qs := r.URL.Query()
+
+	from, err := parseVersion(qs.Get("from"), post.Version-1)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	to, err := parseVersion(qs.Get("to"), post.Version)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if from < 0 || to > post.Version || from >= to {
+		app.badRequetResponse(w, r, fmt.Errorf("versions must satisfy 0 <= from < to <= %d", post.Version))
+		return
+	}
+
+	older, err := app.revisionAt(r, post, from)
+	if err != nil {
+		app.revisionErrorResponse(w, r, err)
+		return
+	}
+
+	newer, err := app.revisionAt(r, post, to)
+	if err != nil {
+		app.revisionErrorResponse(w, r, err)
+		return
+	}
+
+	result := RevisionDiff{
+		PostID:  post.ID,
+		From:    from,
+		To:      to,
+		Title:   diff.Words(older.Title, newer.Title),
+		Content: diff.Words(older.Content, newer.Content),
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, result); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// revisionAt returns the post as it was at version, the live post holds the latest one.
+func (app *app) revisionAt(r *http.Request, post *repository.Post, version int) (*repository.PostRevision, error) {
+	if version == post.Version {
+		return &repository.PostRevision{
+			PostID:    post.ID,
+			Version:   post.Version,
+			Title:     post.Title,
+			Content:   post.Content,
+			Tags:      post.Tags,
+			CreatedAt: post.UpdatedAt,
+		}, nil
+	}
+
+	return app.store.Revisions.GetByVersion(r.Context(), post.ID, version)
+}
+
+func (app *app) revisionErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, repository.ErrorNotFound):
+		app.notFounResponse(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
+
+func parseVersion(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version %q", value)
+	}
+
+	return version, nil
+}
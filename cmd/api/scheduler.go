@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/events"
+)
+
+func (app *app) startBackgroundJobs(ctx context.Context) {
+	app.events.Subscribe("notifications", app.recordNotifications,
+		events.UserFollowed, events.PostReacted, events.PostCreated, events.CommentCreated)
+	app.events.Subscribe("stream", app.publishStreamEvents,
+		events.PostCreated, events.CommentCreated, events.CommentUpdated, events.CommentDeleted)
+	// deliveries are recorded before the request returns so they are always retried
+	app.events.SubscribeSync("webhooks", app.enqueueWebhooks,
+		events.PostCreated, events.CommentCreated, events.UserFollowed)
+	app.events.Run(ctx, app.config.events.workers)
+
+	go app.runStreamBridge(ctx)
+
+	go app.runOnce(ctx, "normalize-legacy-tags", app.normalizeLegacyTags)
+
+	go app.runEvery(ctx, "run-timeline-jobs", app.config.timeline.interval, app.runTimelineJobs)
+	go app.runEvery(ctx, "publish-scheduled-posts", app.config.scheduler.interval, app.publishScheduledPosts)
+	go app.runEvery(ctx, "purge-deleted-posts", time.Hour, app.purgeDeletedPosts)
+	go app.runEvery(ctx, "purge-expired-mutes", time.Hour, app.purgeExpiredMutes)
+	go app.runEvery(ctx, "purge-stream-events", time.Hour, app.purgeStreamEvents)
+	go app.runEvery(ctx, "send-notification-emails", app.config.mail.interval, app.sendNotificationEmails)
+	go app.runEvery(ctx, "send-email-digests", time.Hour, app.sendEmailDigests)
+	go app.runEvery(ctx, "deliver-webhooks", app.config.webhooks.interval, app.deliverWebhooks)
+	go app.runEvery(ctx, "purge-webhook-deliveries", time.Hour, app.purgeWebhookDeliveries)
+}
+
+// runEvery calls fn on every tick of interval until ctx is cancelled.
+func (app *app) runEvery(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := fn(ctx); err != nil {
+				app.logger.Errorw("background job failed", "job", name, "error", err)
+			}
+		}
+	}
+}
+
+// runOnce calls fn a single time, for jobs that catch up on old data at startup.
+func (app *app) runOnce(ctx context.Context, name string, fn func(context.Context) error) {
+	if err := fn(ctx); err != nil {
+		app.logger.Errorw("background job failed", "job", name, "error", err)
+	}
+}
+
+func (app *app) publishScheduledPosts(ctx context.Context) error {
+	batchSize := app.config.scheduler.batchSize
+
+	for {
+		posts, err := app.store.Posts.PublishDue(ctx, batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, post := range posts {
+			app.logger.Infow("scheduled post published", "post_id", post.ID, "user_id", post.UserId)
+			app.postPublished(ctx, post)
+		}
+
+		if len(posts) < batchSize {
+			return nil
+		}
+	}
+}
+
+// normalizeLegacyTags brings the tags of posts written before hashtags were
+// merged into them in line with new posts, so tag pages find them. Instances
+// starting together share the work, the posts are claimed batch by batch.
+func (app *app) normalizeLegacyTags(ctx context.Context) error {
+	batchSize := app.config.scheduler.batchSize
+
+	for {
+		n, err := app.store.Posts.NormalizeLegacyTags(ctx, batchSize)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			app.logger.Infow("normalized tags of legacy posts", "count", n)
+		}
+
+		if n < batchSize {
+			return nil
+		}
+	}
+}
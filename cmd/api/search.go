@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/carlosEA28/Social/internal/repository"
+)
+
+var (
+	errSearchQuery = errors.New("q is required and must be at most 100 characters")
+	errSearchType  = errors.New("type must be posts, users or comments")
+)
+
+func (app *app) searchHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" || utf8.RuneCountInString(q) > 100 {
+		app.badRequetResponse(w, r, errSearchQuery)
+		return
+	}
+
+	fq, err := app.parsePagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	// results come by relevance, so the cursor carries how many were already served
+	if fq.Cursor != nil {
+		fq.Offset = int(fq.Cursor.ID)
+	}
+
+	ctx := r.Context()
+
+	var results any
+	var count int
+
+	switch r.URL.Query().Get("type") {
+	case "", "posts":
+		posts, err := app.store.Search.Posts(ctx, q, getUserFromContext(r).ID, fq)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		hydrate := make([]*repository.Post, len(posts))
+		for i := range posts {
+			hydrate[i] = &posts[i].Post
+		}
+
+		if err := app.hydratePosts(ctx, hydrate...); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		results, count = posts, len(posts)
+	case "comments":
+		comments, err := app.store.Search.Comments(ctx, q, getUserFromContext(r).ID, fq)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		results, count = comments, len(comments)
+	case "users":
+		users, err := app.store.Search.Users(ctx, q, getUserFromContext(r).ID, fq)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		results, count = users, len(users)
+	default:
+		app.badRequetResponse(w, r, errSearchType)
+		return
+	}
+
+	var next *repository.Cursor
+	if count == fq.Limit {
+		next = &repository.Cursor{ID: int64(fq.Offset + count)}
+	}
+
+	if err := app.paginatedResponse(w, r, results, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/events"
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/carlosEA28/Social/internal/stream"
+)
+
+const (
+	// streamBuffer is how many events a connection can fall behind before it is
+	// dropped, the client then reconnects and resumes.
+	streamBuffer = 64
+	// streamReplayLimit bounds how many missed events are replayed on resume.
+	streamReplayLimit = 500
+	// streamMaxPosts bounds how many posts a connection can follow the comments of.
+	streamMaxPosts = 20
+	// streamRetry is how long clients wait before reconnecting, in milliseconds.
+	streamRetry = 3000
+
+	streamNotificationCreated = "notification.created"
+	// streamReset tells a client that resumed too far behind to reload instead.
+	streamReset = "stream.reset"
+)
+
+var errStreamPosts = fmt.Errorf("posts must be at most %d comma separated post ids", streamMaxPosts)
+
+// streamHandler pushes over Server-Sent Events the caller's notifications, the
+// new posts of the accounts they follow and the comments of the posts listed in
+// ?posts=. Clients resume with the Last-Event-ID header, or ?last_event_id= for
+// the first connection. Accounts followed or muted once the stream is open are
+// only taken into account on the next connection.
+func (app *app) streamHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	postIds, err := parseIds(r.URL.Query().Get("posts"), streamMaxPosts)
+	if err != nil {
+		app.badRequetResponse(w, r, errStreamPosts)
+		return
+	}
+
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = r.URL.Query().Get("last_event_id")
+	}
+
+	var resumeFrom int64
+	if lastEventId != "" {
+		resumeFrom, err = strconv.ParseInt(lastEventId, 10, 64)
+		if err != nil {
+			app.badRequetResponse(w, r, fmt.Errorf("invalid Last-Event-ID %q", lastEventId))
+			return
+		}
+	}
+
+	topics := []string{stream.UserTopic(user.ID)}
+
+	for _, id := range postIds {
+		post, err := app.store.Posts.GetById(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrorNotFound):
+				app.notFounResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		visible, err := app.canSeePost(ctx, user, post)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !visible {
+			app.notFounResponse(w, r, repository.ErrorNotFound)
+			return
+		}
+
+		topics = append(topics, stream.PostTopic(id))
+	}
+
+	authorIds, err := app.store.Stream.GetAuthorIds(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	for _, id := range authorIds {
+		topics = append(topics, stream.AuthorTopic(id))
+	}
+
+	blockedIds, err := app.store.Blocks.GetBlockedIds(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	blocked := make(map[int64]bool, len(blockedIds))
+	for _, id := range blockedIds {
+		blocked[id] = true
+	}
+
+	// the stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// subscribe before replaying so nothing published in between is missed
+	sub := app.hub.Subscribe(topics, streamBuffer)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+
+	var replayed int64
+	if resumeFrom > 0 {
+		missed, err := app.store.Stream.GetSince(ctx, topics, resumeFrom, streamReplayLimit)
+		if err != nil {
+			app.logger.Errorw("stream replay failed", "user_id", user.ID, "error", err)
+			return
+		}
+
+		if len(missed) == streamReplayLimit {
+			fmt.Fprintf(w, "event: %s\ndata: {}\n\n", streamReset)
+			rc.Flush()
+			return
+		}
+
+		for _, e := range missed {
+			if blocked[e.ActorID] {
+				continue
+			}
+
+			if err := writeStreamEvent(w, e); err != nil {
+				return
+			}
+		}
+
+		if n := len(missed); n > 0 {
+			replayed = missed[n-1].ID
+		}
+	}
+
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(app.config.stream.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e := <-sub.C:
+			if (e.ID != 0 && e.ID <= replayed) || blocked[e.ActorID] {
+				continue
+			}
+
+			if err := writeStreamEvent(w, e); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeStreamEvent writes e in the text/event-stream format, events without an
+// id leave the client's last event id as it was.
+func writeStreamEvent(w io.Writer, e stream.Event) error {
+	if e.ID != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", e.ID); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, e.Data)
+	return err
+}
+
+// publishStreamEvents relays new posts and comment changes to the stream topics
+// of their author and post.
+func (app *app) publishStreamEvents(ctx context.Context, e events.Event) error {
+	switch e.Type {
+	case events.PostCreated:
+		post, err := app.store.Posts.GetById(ctx, e.PostID)
+		if err != nil {
+			return ignoreNotFound(err)
+		}
+
+		return app.publishStreamEvent(ctx, stream.AuthorTopic(post.UserId), e.Type, e.ActorID, post)
+
+	case events.CommentCreated, events.CommentUpdated:
+		comment, err := app.store.Comment.GetById(ctx, e.CommentID)
+		if err != nil {
+			return ignoreNotFound(err)
+		}
+
+		return app.publishStreamEvent(ctx, stream.PostTopic(comment.PostID), e.Type, e.ActorID, comment)
+
+	case events.CommentDeleted:
+		return app.publishStreamEvent(ctx, stream.PostTopic(e.PostID), e.Type, e.ActorID, map[string]int64{
+			"id":      e.CommentID,
+			"post_id": e.PostID,
+		})
+	}
+
+	return nil
+}
+
+// publishStreamEvent stores an event for the subscribers of topic on every instance.
+func (app *app) publishStreamEvent(ctx context.Context, topic, eventType string, actorId int64, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return app.store.Stream.Publish(ctx, &stream.Event{
+		Topic:   topic,
+		Type:    eventType,
+		ActorID: actorId,
+		Data:    payload,
+	})
+}
+
+// runStreamBridge relays the stream events of every instance to the local hub,
+// starting over if the listener can't be set up.
+func (app *app) runStreamBridge(ctx context.Context) {
+	onError := func(err error) {
+		app.logger.Warnw("stream listener error", "error", err)
+	}
+
+	for {
+		err := stream.Listen(ctx, app.config.db.addr, app.hub, app.store.Stream.GetById, onError)
+		if err != nil {
+			app.logger.Errorw("stream listener failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * 10):
+		}
+	}
+}
+
+func (app *app) purgeStreamEvents(ctx context.Context) error {
+	purged, err := app.store.Stream.Purge(ctx, time.Now().Add(-app.config.stream.retention))
+	if err != nil {
+		return err
+	}
+
+	if purged > 0 {
+		app.logger.Infow("stream events purged", "count", purged)
+	}
+
+	return nil
+}
+
+// parseIds reads a comma separated list of at most max ids.
+func parseIds(raw string, max int) ([]int64, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(raw, ",")
+	if len(parts) > max {
+		return nil, fmt.Errorf("at most %d ids", max)
+	}
+
+	ids := make([]int64, len(parts))
+	for i, part := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+
+	return ids, nil
+}
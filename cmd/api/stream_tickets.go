@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/repository"
+)
+
+// streamTicketTTL is how long a stream ticket can be used to connect for.
+const streamTicketTTL = 30 * time.Second
+
+type streamTicketKey string
+
+const streamTicketCtx streamTicketKey = "streamTicket"
+
+var errInvalidStreamTicket = errors.New("invalid or expired stream ticket")
+
+// streamTicket lets clients that can't set headers, such as the browser's
+// EventSource and WebSocket, open a stream without putting their access token in
+// a URL where access and proxy logs would keep it. It is only accepted by the
+// stream endpoints and only for streamTicketTTL.
+type streamTicket struct {
+	UserID    int64     `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// createStreamTicketHandler issues a ticket for the caller to pass as ?ticket=
+// when opening a stream.
+func (app *app) createStreamTicketHandler(w http.ResponseWriter, r *http.Request) {
+	ticket := streamTicket{
+		UserID:    getUserFromContext(r).ID,
+		ExpiresAt: time.Now().Add(streamTicketTTL),
+	}
+
+	token, err := app.streamTickets.Sign(ticket)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	response := struct {
+		Ticket    string    `json:"ticket"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{token, ticket.ExpiresAt}
+
+	if err := app.jsonResponse(w, http.StatusCreated, response); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// stripStreamTicket takes ?ticket= out of the URL before the request is logged,
+// the stream endpoints find it in the request context instead.
+func stripStreamTicket(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		qs := r.URL.Query()
+		ticket := qs.Get("ticket")
+		if ticket == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		qs.Del("ticket")
+
+		r = r.WithContext(context.WithValue(r.Context(), streamTicketCtx, ticket))
+		r.URL.RawQuery = qs.Encode()
+		r.RequestURI = r.URL.RequestURI()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// streamAuthMiddleware authenticates the stream endpoints with a stream ticket
+// when there is one and with the Authorization header otherwise.
+func (app *app) streamAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := r.Context().Value(streamTicketCtx).(string)
+		if raw == "" {
+			app.AuthTokenMiddleware(next).ServeHTTP(w, r)
+			return
+		}
+
+		var ticket streamTicket
+		if err := app.streamTickets.Verify(raw, &ticket); err != nil || time.Now().After(ticket.ExpiresAt) {
+			app.unauthorizedErrorReposnse(w, r, errInvalidStreamTicket)
+			return
+		}
+
+		ctx := r.Context()
+
+		user, err := app.store.Users.GetUserById(ctx, ticket.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrorNotFound):
+				app.unauthorizedErrorReposnse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, userCtx, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/carlosEA28/Social/internal/repository"
+)
+
+// getSuggestionsHandler lists who the caller might want to follow among the
+// accounts followed by the people they follow.
+func (app *app) getSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := app.parseUnfilteredPagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	// suggestions are ranked, so the cursor carries how many were already served
+	if fq.Cursor != nil {
+		fq.Offset = int(fq.Cursor.ID)
+	}
+
+	suggestions, err := app.store.Followers.GetSuggestions(r.Context(), getUserFromContext(r).ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	for i := range suggestions {
+		suggestions[i].Reason = suggestionReason(suggestions[i])
+	}
+
+	var next *repository.Cursor
+	if len(suggestions) == fq.Limit {
+		next = &repository.Cursor{ID: int64(fq.Offset + len(suggestions))}
+	}
+
+	if err := app.paginatedResponse(w, r, suggestions, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// suggestionReason explains a suggestion as in "followed by alice and 3 others".
+func suggestionReason(s repository.Suggestion) string {
+	if len(s.FollowedBy) == 0 {
+		return ""
+	}
+
+	return "followed by " + namesAndOthers(s.FollowedBy, s.MutualCount)
+}
+
+// namesAndOthers names the first of total people as "alice", "alice and bob" or
+// "alice and 3 others", names holds the known names of the first few of them.
+func namesAndOthers(names []string, total int) string {
+	switch others := total - 1; {
+	case len(names) == 0:
+		return fmt.Sprintf("%d people", total)
+	case others <= 0:
+		return names[0]
+	case others == 1 && len(names) > 1:
+		return strings.Join(names[:2], " and ")
+	case others == 1:
+		return names[0] + " and 1 other"
+	default:
+		return fmt.Sprintf("%s and %d others", names[0], others)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/entities"
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+var trendingWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"6h":  time.Hour * 6,
+	"24h": time.Hour * 24,
+	"7d":  time.Hour * 24 * 7,
+}
+
+func (app *app) getTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	tag := entities.NormalizeTag(chi.URLParam(r, "tag"))
+	if tag == "" {
+		app.badRequetResponse(w, r, errors.New("invalid tag"))
+		return
+	}
+
+	fq, err := app.parsePagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	tagged, err := app.store.Posts.GetByTag(ctx, tag, getUserFromContext(r).ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	posts := make([]*repository.Post, len(tagged))
+	for i := range tagged {
+		posts[i] = &tagged[i].Post
+	}
+
+	if err := app.hydratePosts(ctx, posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var next *repository.Cursor
+	if n := len(tagged); n > 0 {
+		next = nextCursor(fq, n, tagged[n-1].CreatedAt, tagged[n-1].ID)
+	}
+
+	if err := app.paginatedResponse(w, r, tagged, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *app) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	window := trendingWindows["24h"]
+	if param := qs.Get("window"); param != "" {
+		d, ok := trendingWindows[param]
+		if !ok {
+			app.badRequetResponse(w, r, errors.New("window must be one of 1h, 6h, 24h or 7d"))
+			return
+		}
+		window = d
+	}
+
+	limit := 10
+	if l := qs.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 50 {
+			app.badRequetResponse(w, r, errors.New("limit must be a number between 1 and 50"))
+			return
+		}
+		limit = n
+	}
+
+	tags, err := app.store.Tags.Trending(r.Context(), window, limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func hashtagEntities(content string) []repository.Hashtag {
+	hashtags := []repository.Hashtag{}
+	for _, h := range entities.ParseHashtags(content) {
+		hashtags = append(hashtags, repository.Hashtag{Tag: h.Tag, Start: h.Start, End: h.End})
+	}
+
+	return hashtags
+}
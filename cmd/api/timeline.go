@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/carlosEA28/Social/internal/repository/cache"
+)
+
+// fanOutBatchSize bounds how many follower timelines a single insert writes to.
+const fanOutBatchSize = 1000
+
+// enqueueTimelineJob saves job for the timeline workers so that requests don't
+// wait on writing to every follower's timeline. The request that caused the job
+// has already succeeded when it can't be saved, so that is only logged.
+func (app *app) enqueueTimelineJob(ctx context.Context, job repository.TimelineJob) {
+	if err := app.store.Timelines.EnqueueJob(ctx, &job); err != nil {
+		app.logger.Errorw("error saving timeline job", "kind", job.Kind, "author_id", job.AuthorID,
+			"post_id", job.PostID, "follower_id", job.FollowerID, "error", err)
+	}
+}
+
+// enqueueFanOut pushes a freshly published post into the timelines of its author and followers.
+func (app *app) enqueueFanOut(ctx context.Context, post repository.Post) {
+	app.enqueueTimelineJob(ctx, repository.TimelineJob{Kind: repository.TimelineJobFanOut, AuthorID: post.UserId, PostID: post.ID})
+}
+
+// enqueueBackfill copies the recent posts of authorId into the timeline of a new follower.
+func (app *app) enqueueBackfill(ctx context.Context, followerId, authorId int64) {
+	app.enqueueTimelineJob(ctx, repository.TimelineJob{Kind: repository.TimelineJobBackfill, AuthorID: authorId, FollowerID: followerId})
+}
+
+// enqueueTimelineRemoval takes the posts of authorId out of the timeline of a former follower.
+func (app *app) enqueueTimelineRemoval(ctx context.Context, followerId, authorId int64) {
+	app.enqueueTimelineJob(ctx, repository.TimelineJob{Kind: repository.TimelineJobRemove, AuthorID: authorId, FollowerID: followerId})
+}
+
+// runTimelineJobs runs the timeline jobs that are due, as many at a time as there
+// are timeline workers, until none is left.
+func (app *app) runTimelineJobs(ctx context.Context) error {
+	cfg := app.config.timeline
+
+	for {
+		jobs, err := app.store.Timelines.ClaimJobs(ctx, cfg.workers, time.Now().Add(cfg.lease))
+		if err != nil {
+			return err
+		}
+
+		var wg sync.WaitGroup
+		for _, job := range jobs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				app.runTimelineJob(ctx, job)
+			}()
+		}
+		wg.Wait()
+
+		if len(jobs) < cfg.workers || ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// runTimelineJob runs job and removes it once it is done. A job that fails stays
+// saved and is claimed again when its lease is over, the jobs are idempotent.
+func (app *app) runTimelineJob(ctx context.Context, job repository.TimelineJob) {
+	var err error
+	switch job.Kind {
+	case repository.TimelineJobFanOut:
+		err = app.fanOutPost(ctx, job.PostID)
+	case repository.TimelineJobBackfill:
+		err = app.backfillTimeline(ctx, job.FollowerID, job.AuthorID)
+	case repository.TimelineJobRemove:
+		err = app.removeFromTimeline(ctx, job.FollowerID, job.AuthorID)
+	default:
+		err = fmt.Errorf("unknown timeline job kind %q", job.Kind)
+	}
+
+	if err != nil {
+		app.logger.Errorw("timeline job failed, it will be retried", "job_id", job.ID, "kind", job.Kind,
+			"attempts", job.Attempts, "error", err)
+		return
+	}
+
+	if err := app.store.Timelines.CompleteJob(ctx, job.ID); err != nil {
+		app.logger.Errorw("error completing timeline job", "job_id", job.ID, "error", err)
+	}
+}
+
+// fanOutPost writes the post to the timeline of its author and, unless the author
+// is above the celebrity threshold, of all their followers. Celebrity posts are
+// merged in when the timeline is read instead. Posts deleted or unpublished
+// before their turn came are skipped.
+func (app *app) fanOutPost(ctx context.Context, postId int64) error {
+	post, err := app.store.Posts.GetById(ctx, postId)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	if !post.IsPublished() {
+		return nil
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, post.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	entry := repository.TimelineEntry{PostID: post.ID, AuthorID: post.UserId, CreatedAt: createdAt}
+
+	recipients := []int64{post.UserId}
+
+	celebrity, err := app.isCelebrity(ctx, post.UserId)
+	if err != nil {
+		return err
+	}
+
+	if !celebrity {
+		followers, err := app.store.Followers.GetFollowerIds(ctx, post.UserId)
+		if err != nil {
+			return err
+		}
+
+		recipients = append(recipients, followers...)
+	}
+
+	for start := 0; start < len(recipients); start += fanOutBatchSize {
+		batch := recipients[start:min(start+fanOutBatchSize, len(recipients))]
+
+		if err := app.store.Timelines.Push(ctx, batch, []repository.TimelineEntry{entry}); err != nil {
+			return err
+		}
+
+		if app.config.redisCfg.enabled {
+			if err := app.cacheStorage.Timelines.Push(ctx, batch, entry); err != nil {
+				app.logger.Warnw("timeline cache push failed", "post_id", post.ID, "error", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// backfillTimeline copies the recent posts of authorId into the timeline of
+// followerId, unless they stopped following meanwhile.
+func (app *app) backfillTimeline(ctx context.Context, followerId, authorId int64) error {
+	rel, err := app.store.Followers.GetRelationship(ctx, followerId, authorId)
+	if err != nil || !rel.Following {
+		return err
+	}
+
+	celebrity, err := app.isCelebrity(ctx, authorId)
+	if err != nil || celebrity {
+		return err
+	}
+
+	fq := repository.PaginatedFeedQuery{Limit: app.config.timeline.backfillSize}
+
+	entries, err := app.store.Posts.GetTimelineEntries(ctx, []int64{authorId}, fq)
+	if err != nil {
+		return err
+	}
+
+	if err := app.store.Timelines.Push(ctx, []int64{followerId}, entries); err != nil {
+		return err
+	}
+
+	app.invalidateTimeline(ctx, followerId)
+	return nil
+}
+
+// removeFromTimeline drops the posts of authorId from the timeline of followerId,
+// unless they followed again meanwhile.
+func (app *app) removeFromTimeline(ctx context.Context, followerId, authorId int64) error {
+	rel, err := app.store.Followers.GetRelationship(ctx, followerId, authorId)
+	if err != nil || rel.Following {
+		return err
+	}
+
+	if err := app.store.Timelines.RemoveAuthor(ctx, followerId, authorId); err != nil {
+		return err
+	}
+
+	app.invalidateTimeline(ctx, followerId)
+	return nil
+}
+
+func (app *app) isCelebrity(ctx context.Context, userId int64) (bool, error) {
+	count, err := app.store.Followers.CountFollowers(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+
+	return count > app.config.timeline.celebrityThreshold, nil
+}
+
+func (app *app) invalidateTimeline(ctx context.Context, userId int64) {
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	if err := app.cacheStorage.Timelines.Invalidate(ctx, userId); err != nil {
+		app.logger.Warnw("timeline cache invalidation failed", "user_id", userId, "error", err)
+	}
+}
+
+// homeTimeline reads a page of the materialized timeline of userId merged with
+// the posts of the celebrities they follow. The returned cursor follows the
+// timeline entries, so posts deleted since they were pushed don't end paging early.
+func (app *app) homeTimeline(ctx context.Context, userId int64, fq repository.PaginatedFeedQuery) ([]repository.PostWithMetadata, *repository.Cursor, error) {
+	entries, err := app.timelineEntries(ctx, userId, fq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	celebrities, err := app.store.Followers.GetFollowedAbove(ctx, userId, app.config.timeline.celebrityThreshold)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(celebrities) > 0 {
+		pulled, err := app.store.Posts.GetTimelineEntries(ctx, celebrities, fq)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		entries = mergeTimelines(fq.Limit, entries, pulled)
+	}
+
+	var next *repository.Cursor
+	if n := len(entries); n == fq.Limit {
+		next = &repository.Cursor{At: entries[n-1].CreatedAt, ID: entries[n-1].PostID}
+	}
+
+	if len(entries) == 0 {
+		return []repository.PostWithMetadata{}, next, nil
+	}
+
+	ids := make([]int64, len(entries))
+	for i, e := range entries {
+		ids[i] = e.PostID
+	}
+
+	feed, err := app.store.Posts.GetFeedByIds(ctx, ids, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return feed, next, nil
+}
+
+// timelineEntries reads the timeline from Redis when it is cached there and from
+// Postgres otherwise, warming the cache when the first page misses it.
+func (app *app) timelineEntries(ctx context.Context, userId int64, fq repository.PaginatedFeedQuery) ([]repository.TimelineEntry, error) {
+	if !app.config.redisCfg.enabled {
+		return app.store.Timelines.Get(ctx, userId, fq)
+	}
+
+	entries, ok, err := app.cacheStorage.Timelines.Get(ctx, userId, fq)
+	if err != nil {
+		app.logger.Warnw("timeline cache read failed", "user_id", userId, "error", err)
+		return app.store.Timelines.Get(ctx, userId, fq)
+	}
+
+	if ok {
+		return entries, nil
+	}
+
+	if fq.Cursor != nil {
+		return app.store.Timelines.Get(ctx, userId, fq)
+	}
+
+	latest, err := app.store.Timelines.Get(ctx, userId, repository.PaginatedFeedQuery{Limit: cache.TimelineSize})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := app.cacheStorage.Timelines.Warm(ctx, userId, latest); err != nil {
+		app.logger.Warnw("timeline cache warm failed", "user_id", userId, "error", err)
+	}
+
+	return latest[:min(len(latest), fq.Limit)], nil
+}
+
+// mergeTimelines merges timelines sorted newest first into one of at most limit
+// entries, keeping a single entry per post.
+func mergeTimelines(limit int, a, b []repository.TimelineEntry) []repository.TimelineEntry {
+	merged := make([]repository.TimelineEntry, 0, limit)
+	seen := make(map[int64]bool, limit)
+
+	for len(merged) < limit && (len(a) > 0 || len(b) > 0) {
+		var e repository.TimelineEntry
+		if len(b) == 0 || (len(a) > 0 && a[0].Before(b[0])) {
+			e, a = a[0], a[1:]
+		} else {
+			e, b = b[0], b[1:]
+		}
+
+		if seen[e.PostID] {
+			continue
+		}
+
+		seen[e.PostID] = true
+		merged = append(merged, e)
+	}
+
+	return merged
+}
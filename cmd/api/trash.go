@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+func (app *app) getTrashHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := app.parsePagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+	ownerId := user.ID
+
+	// admins can look through everyone's trash
+	if r.URL.Query().Get("all") == "true" {
+		allowed, err := app.checkRolePrecedence(ctx, user, "admin")
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbidenResponse(w, r)
+			return
+		}
+
+		ownerId = 0
+	}
+
+	trash, err := app.store.Posts.GetTrash(ctx, ownerId, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	posts := make([]*repository.Post, len(trash))
+	for i := range trash {
+		posts[i] = &trash[i]
+	}
+
+	if err := app.hydratePosts(ctx, posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var next *repository.Cursor
+	if n := len(trash); n == fq.Limit {
+		next = &repository.Cursor{At: *trash[n-1].DeletedAt, ID: trash[n-1].ID}
+	}
+
+	if err := app.paginatedResponse(w, r, trash, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *app) restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "postId"), 10, 64)
+	if err != nil {
+		app.badRequetResponse(w, r, errors.New("invalid post ID"))
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	post, err := app.store.Posts.GetDeletedById(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if post.UserId != user.ID {
+		allowed, err := app.checkRolePrecedence(ctx, user, "admin")
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbidenResponse(w, r)
+			return
+		}
+	}
+
+	if err := app.store.Posts.Restore(ctx, post.ID); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	post.DeletedAt = nil
+	post.DeletedBy = nil
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *app) purgeDeletedPosts(ctx context.Context) error {
+	cutoff := time.Now().Add(-app.config.scheduler.trashRetention)
+
+	purged, keys, err := app.store.Posts.PurgeDeleted(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := app.blobs.Delete(ctx, key); err != nil {
+			app.logger.Errorw("error deleting blob", "key", key, "error", err)
+		}
+	}
+
+	if purged > 0 {
+		app.logger.Infow("purged deleted posts", "count", purged)
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/carlosEA28/Social/internal/repository"
+)
+
+// getUserPostsHandler lists the posts of a user, most recent first, mixed with
+// their replies with ?with_replies=true or only those with attachments with
+// ?media_only=true. The first page also carries the posts they pinned, unless
+// the posts are narrowed by tags, search or dates.
+func (app *app) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := app.parsePagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var withReplies, mediaOnly bool
+	if raw := query.Get("with_replies"); raw != "" {
+		withReplies, err = strconv.ParseBool(raw)
+		if err != nil {
+			app.badRequetResponse(w, r, fmt.Errorf("invalid with_replies %q", raw))
+			return
+		}
+	}
+
+	if raw := query.Get("media_only"); raw != "" {
+		mediaOnly, err = strconv.ParseBool(raw)
+		if err != nil {
+			app.badRequetResponse(w, r, fmt.Errorf("invalid media_only %q", raw))
+			return
+		}
+	}
+
+	if withReplies && mediaOnly {
+		app.badRequetResponse(w, r, errors.New("with_replies and media_only can't be used together"))
+		return
+	}
+
+	// tags, search and dates narrow posts, replies have none of their own
+	if withReplies && fq.Filtered() {
+		app.badRequetResponse(w, r, errors.New("with_replies can't be used with tags, search, since or until"))
+		return
+	}
+
+	ctx := r.Context()
+	target := getTargetUserFromCtx(r)
+	viewer := getUserFromContext(r)
+
+	entries, err := app.store.Posts.GetProfileTimeline(ctx, target.ID, viewer.ID, withReplies, mediaOnly, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// pinned posts sit above the first page only, they are not part of the pages
+	var pinned []repository.PostWithMetadata
+	if fq.Cursor == nil && fq.Offset == 0 && !mediaOnly && !fq.Filtered() {
+		pinned, err = app.store.Posts.GetPinned(ctx, target.ID, viewer.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.hydrateProfileEntries(ctx, entries, pinned); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var next *repository.Cursor
+	if n := len(entries); n > 0 {
+		next = nextCursor(fq, n, entries[n-1].CreatedAt, entries[n-1].SortKey)
+	}
+
+	token, err := app.nextPageLink(w, r, next)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	type envelope struct {
+		Data       []repository.ProfileEntry     `json:"data"`
+		Pinned     []repository.PostWithMetadata `json:"pinned,omitempty"`
+		NextCursor *string                       `json:"next_cursor"`
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{Data: entries, Pinned: pinned, NextCursor: token}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// hydrateProfileEntries fills in the posts and replies of a profile page and the
+// pinned posts above it.
+func (app *app) hydrateProfileEntries(ctx context.Context, entries []repository.ProfileEntry, pinned []repository.PostWithMetadata) error {
+	var posts []*repository.Post
+	var replies []repository.Comment
+	for _, entry := range entries {
+		// replies come with the post they were made on
+		posts = append(posts, &entry.Post.Post)
+		if entry.Reply != nil {
+			replies = append(replies, *entry.Reply)
+		}
+	}
+
+	for i := range pinned {
+		posts = append(posts, &pinned[i].Post)
+	}
+
+	if err := app.hydratePosts(ctx, posts...); err != nil {
+		return err
+	}
+
+	if err := app.hydrateComments(ctx, replies); err != nil {
+		return err
+	}
+
+	// hydrateComments works on copies, the entries get them back in the same order
+	i := 0
+	for _, entry := range entries {
+		if entry.Reply != nil {
+			*entry.Reply = replies[i]
+			i++
+		}
+	}
+
+	return nil
+}
+
+// pinPostHandler pins a published post to the top of its author's profile, up
+// to repository.MaxPinnedPosts of them.
+func (app *app) pinPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	if post.UserId != getUserFromContext(r).ID {
+		app.forbidenResponse(w, r)
+		return
+	}
+
+	if !post.IsPublished() {
+		app.badRequetResponse(w, r, errors.New("only published posts can be pinned"))
+		return
+	}
+
+	if err := app.store.Posts.Pin(r.Context(), post); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorPinLimit):
+			app.badRequetResponse(w, r, err)
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *app) unpinPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	if post.UserId != getUserFromContext(r).ID {
+		app.forbidenResponse(w, r)
+		return
+	}
+
+	if err := app.store.Posts.Unpin(r.Context(), post.ID); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
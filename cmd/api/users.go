@@ -1,66 +1,225 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/carlosEA28/Social/internal/events"
 	"github.com/carlosEA28/Social/internal/repository"
 	"github.com/go-chi/chi/v5"
 )
 
 type userKey string
 
-const userCtx userKey = "user"
+const (
+	userCtx       userKey = "user"
+	targetUserCtx userKey = "targetUser"
+)
 
 func (app *app) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	target := getTargetUserFromCtx(r)
+
+	profile, err := app.store.Users.GetProfile(r.Context(), target.ID, getUserFromContext(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, profile); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type UpdateProfilePayload struct {
+	IsPrivate       *bool `json:"is_private"`
+	DMFollowersOnly *bool `json:"dm_followers_only"`
+}
+
+func (app *app) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateProfilePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
 	user := getUserFromContext(r)
 
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+	if payload.IsPrivate != nil && *payload.IsPrivate != user.IsPrivate {
+		// going public lets everyone who was waiting in
+		approved, err := app.store.Users.SetPrivate(ctx, user.ID, *payload.IsPrivate)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		for _, requesterId := range approved {
+			app.enqueueBackfill(ctx, requesterId, user.ID)
+		}
+	}
+
+	if payload.DMFollowersOnly != nil {
+		if err := app.store.Users.SetDMFollowersOnly(ctx, user.ID, *payload.DMFollowersOnly); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	profile, err := app.store.Users.GetProfile(ctx, user.ID, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, profile); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
 
-func (app *app) followUserHandler(w http.ResponseWriter, r *http.Request) {
-	followerUser := getUserFromContext(r)
-	followedUserId, err := strconv.ParseInt(chi.URLParam(r, "UserId"), 10, 64)
+func (app *app) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.followListResponse(w, r, app.store.Followers.GetFollowers)
+}
 
+func (app *app) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.followListResponse(w, r, app.store.Followers.GetFollowing)
+}
+
+type followListFunc func(ctx context.Context, userId int64, viewerId int64, fq repository.PaginatedFeedQuery) ([]repository.FollowListEntry, error)
+
+// followListResponse writes a page of the follow list of the user in the URL as
+// seen by the caller.
+func (app *app) followListResponse(w http.ResponseWriter, r *http.Request, list followListFunc) {
+	fq, err := app.parseUnfilteredPagination(r)
 	if err != nil {
 		app.badRequetResponse(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusNoContent, followerUser); err != nil {
+	ctx := r.Context()
+	target := getTargetUserFromCtx(r)
+	viewer := getUserFromContext(r)
+
+	// the follow lists of a private account are as private as its posts
+	visible, err := app.store.Users.CanView(ctx, viewer.ID, target.ID)
+	if err != nil {
 		app.internalServerError(w, r, err)
+		return
 	}
 
-	ctx := r.Context()
+	if !visible {
+		app.notFounResponse(w, r, repository.ErrorNotFound)
+		return
+	}
 
-	if err := app.store.Followers.Follow(ctx, followerUser.ID, followedUserId); err != nil {
+	entries, err := list(ctx, target.ID, viewer.ID, fq)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+	var next *repository.Cursor
+	if n := len(entries); n > 0 {
+		next = nextCursor(fq, n, entries[n-1].FollowedAt, entries[n-1].ID)
+	}
+
+	if err := app.paginatedResponse(w, r, entries, next); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
 
-func (app *app) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
-	followerUser := getUserFromContext(r)
-	unfollowedUserId, err := strconv.ParseInt(chi.URLParam(r, "UserId"), 10, 64)
+var errFollowSelf = errors.New("users can't follow themselves")
+
+// followUserHandler makes the caller follow the user in the URL. Following an
+// account that is already followed succeeds without changes.
+func (app *app) followUserHandler(w http.ResponseWriter, r *http.Request) {
+	follower := getUserFromContext(r)
+	target := getTargetUserFromCtx(r)
+
+	if follower.ID == target.ID {
+		app.badRequetResponse(w, r, errFollowSelf)
+		return
+	}
+
+	ctx := r.Context()
+
+	// private accounts approve their followers, until then the follow is a request
+	if target.IsPrivate {
+		if err := app.store.FollowRequests.Create(ctx, follower.ID, target.ID); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		app.relationshipResponse(w, r, target.ID)
+		return
+	}
+
+	created, err := app.store.Followers.Follow(ctx, follower.ID, target.ID)
 	if err != nil {
-		app.badRequetResponse(w, r, err)
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
+	if created {
+		app.enqueueBackfill(ctx, follower.ID, target.ID)
+		app.events.Publish(ctx, events.Event{Type: events.UserFollowed, ActorID: follower.ID, UserID: target.ID})
+	}
+
+	app.relationshipResponse(w, r, target.ID)
+}
+
+// unfollowUserHandler stops the caller from following the user in the URL and
+// cancels a pending request to do so, unfollowing an account that isn't followed
+// succeeds without changes.
+func (app *app) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	follower := getUserFromContext(r)
+	target := getTargetUserFromCtx(r)
+
 	ctx := r.Context()
 
-	if err := app.store.Followers.Unfollow(ctx, followerUser.ID, unfollowedUserId); err != nil {
+	if _, err := app.store.FollowRequests.Delete(ctx, follower.ID, target.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	removed, err := app.store.Followers.Unfollow(ctx, follower.ID, target.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if removed {
+		app.enqueueTimelineRemoval(ctx, follower.ID, target.ID)
+	}
+
+	app.relationshipResponse(w, r, target.ID)
+}
+
+// relationshipResponse writes how the caller and userId follow each other.
+func (app *app) relationshipResponse(w http.ResponseWriter, r *http.Request, userId int64) {
+	relationship, err := app.store.Followers.GetRelationship(r.Context(), getUserFromContext(r).ID, userId)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+	if err := app.jsonResponse(w, http.StatusOK, relationship); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
@@ -85,7 +244,52 @@ func (app *app) activateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// userContextMiddleware loads the active user named by the userId URL param.
+func (app *app) userContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+		if err != nil {
+			app.badRequetResponse(w, r, errors.New("invalid user ID"))
+			return
+		}
+
+		ctx := r.Context()
+
+		user, err := app.store.Users.GetUserById(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrorNotFound):
+				app.notFounResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		// blocked users don't exist for each other
+		blocked, err := app.store.Blocks.Between(ctx, getUserFromContext(r).ID, user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if blocked {
+			app.notFounResponse(w, r, repository.ErrorNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, targetUserCtx, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func getUserFromContext(r *http.Request) *repository.User {
 	user, _ := r.Context().Value(userCtx).(*repository.User)
 	return user
 }
+
+// getTargetUserFromCtx returns the user named in the URL, as opposed to the caller.
+func getTargetUserFromCtx(r *http.Request) *repository.User {
+	user, _ := r.Context().Value(targetUserCtx).(*repository.User)
+	return user
+}
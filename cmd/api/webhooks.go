@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/events"
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/carlosEA28/Social/internal/webhook"
+	"github.com/go-chi/chi/v5"
+)
+
+type webhookKey string
+
+const webhookCtx webhookKey = "webhook"
+
+var errGlobalWebhook = errors.New("only admins can create global webhooks")
+
+type CreateWebhookPayload struct {
+	URL    string   `json:"url" validate:"required,http_url,max=2048"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=post.created comment.created user.followed"`
+	Global bool     `json:"global"`
+}
+
+type UpdateWebhookPayload struct {
+	URL    *string  `json:"url" validate:"omitempty,http_url,max=2048"`
+	Events []string `json:"events" validate:"omitempty,min=1,dive,oneof=post.created comment.created user.followed"`
+	Active *bool    `json:"active"`
+}
+
+// webhookPayload is the body posted to webhooks, Data depends on Event.
+type webhookPayload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+func (app *app) getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := app.store.Webhooks.GetByUser(r.Context(), getUserFromContext(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, webhooks); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createWebhookHandler registers an endpoint for the events concerning the
+// caller, or for every event of its types when an admin makes it global. The
+// secret deliveries are signed with is only returned here.
+func (app *app) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	if payload.Global {
+		allowed, err := app.checkRolePrecedence(ctx, user, "admin")
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.badRequetResponse(w, r, errGlobalWebhook)
+			return
+		}
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	hook := &repository.Webhook{
+		UserID: user.ID,
+		URL:    payload.URL,
+		Secret: secret,
+		Events: payload.Events,
+		Global: payload.Global,
+	}
+
+	if err := app.store.Webhooks.Create(ctx, hook); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, hook); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *app) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusOK, getWebhookFromCtx(r)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// updateWebhookHandler changes the url, events or active flag of a webhook,
+// reactivating one that was disabled after failing retries its pending deliveries.
+func (app *app) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	hook := getWebhookFromCtx(r)
+
+	if payload.URL != nil {
+		hook.URL = *payload.URL
+	}
+
+	if payload.Events != nil {
+		hook.Events = payload.Events
+	}
+
+	if payload.Active != nil {
+		hook.Active = *payload.Active
+	}
+
+	if err := app.store.Webhooks.Update(r.Context(), hook); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, hook); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *app) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.store.Webhooks.Delete(r.Context(), getWebhookFromCtx(r).ID); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getWebhookDeliveriesHandler lists the deliveries of a webhook, newest first.
+func (app *app) getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := app.parseUnfilteredPagination(r)
+	if err != nil {
+		app.badRequetResponse(w, r, err)
+		return
+	}
+
+	deliveries, err := app.store.Webhooks.GetDeliveries(r.Context(), getWebhookFromCtx(r).ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var next *repository.Cursor
+	if n := len(deliveries); n > 0 {
+		next = nextCursor(fq, n, deliveries[n-1].CreatedAt, deliveries[n-1].ID)
+	}
+
+	if err := app.paginatedResponse(w, r, deliveries, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getWebhookDeliveryHandler returns a delivery along with each of its attempts.
+func (app *app) getWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "deliveryId"), 10, 64)
+	if err != nil {
+		app.badRequetResponse(w, r, errors.New("invalid delivery ID"))
+		return
+	}
+
+	delivery, err := app.store.Webhooks.GetDelivery(r.Context(), getWebhookFromCtx(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, delivery); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// redeliverWebhookHandler queues the payload of a past delivery again as a new
+// delivery, for receivers that lost or mishandled it.
+func (app *app) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "deliveryId"), 10, 64)
+	if err != nil {
+		app.badRequetResponse(w, r, errors.New("invalid delivery ID"))
+		return
+	}
+
+	delivery, err := app.store.Webhooks.Redeliver(r.Context(), getWebhookFromCtx(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrorNotFound):
+			app.notFounResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, delivery); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// webhookContextMiddleware loads the webhook named by the webhookId URL param,
+// webhooks of other users are not found.
+func (app *app) webhookContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "webhookId"), 10, 64)
+		if err != nil {
+			app.badRequetResponse(w, r, errors.New("invalid webhook ID"))
+			return
+		}
+
+		ctx := r.Context()
+
+		hook, err := app.store.Webhooks.GetById(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrorNotFound):
+				app.notFounResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if hook.UserID != getUserFromContext(r).ID {
+			app.notFounResponse(w, r, repository.ErrorNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, webhookCtx, hook)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getWebhookFromCtx(r *http.Request) *repository.Webhook {
+	hook, _ := r.Context().Value(webhookCtx).(*repository.Webhook)
+	return hook
+}
+
+// enqueueWebhooks queues a delivery of e to the global webhooks subscribed to
+// it and to those of the users it concerns: the author of a post, the authors
+// of a comment and of its post, and both sides of a follow. It runs as the event
+// is published, so a delivery exists for every event before the request returns.
+func (app *app) enqueueWebhooks(ctx context.Context, e events.Event) error {
+	var data any
+	var userIds []int64
+
+	switch e.Type {
+	case events.PostCreated:
+		post, err := app.store.Posts.GetById(ctx, e.PostID)
+		if err != nil {
+			return ignoreNotFound(err)
+		}
+
+		data = map[string]any{
+			"id":         post.ID,
+			"user_id":    post.UserId,
+			"title":      post.Title,
+			"content":    post.Content,
+			"tags":       post.Tags,
+			"created_at": post.CreatedAt,
+		}
+		userIds = []int64{post.UserId}
+
+	case events.CommentCreated:
+		comment, err := app.store.Comment.GetById(ctx, e.CommentID)
+		if err != nil {
+			return ignoreNotFound(err)
+		}
+
+		post, err := app.store.Posts.GetById(ctx, comment.PostID)
+		if err != nil {
+			return ignoreNotFound(err)
+		}
+
+		data = map[string]any{
+			"id":         comment.ID,
+			"post_id":    comment.PostID,
+			"user_id":    comment.UserID,
+			"parent_id":  comment.ParentID,
+			"content":    comment.Content,
+			"created_at": comment.CreatedAt,
+		}
+		userIds = []int64{comment.UserID, post.UserId}
+
+	case events.UserFollowed:
+		data = map[string]any{
+			"follower_id": e.ActorID,
+			"user_id":     e.UserID,
+		}
+		userIds = []int64{e.ActorID, e.UserID}
+
+	default:
+		return nil
+	}
+
+	body, err := json.Marshal(webhookPayload{Event: e.Type, CreatedAt: e.At, Data: data})
+	if err != nil {
+		return err
+	}
+
+	_, err = app.store.Webhooks.Enqueue(ctx, e.Type, userIds, body)
+	return err
+}
+
+// deliverWebhooks attempts the deliveries that are due, as many at a time as
+// there are webhook workers, until none is left.
+func (app *app) deliverWebhooks(ctx context.Context) error {
+	cfg := app.config.webhooks
+
+	for {
+		due, err := app.store.Webhooks.ClaimDue(ctx, cfg.workers, time.Now().Add(cfg.timeout*2))
+		if err != nil {
+			return err
+		}
+
+		var wg sync.WaitGroup
+		for _, d := range due {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				app.deliverWebhook(ctx, d)
+			}()
+		}
+		wg.Wait()
+
+		if len(due) < cfg.workers || ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// deliverWebhook makes an attempt at d and records it, scheduling a retry with
+// exponential backoff until the attempts run out.
+func (app *app) deliverWebhook(ctx context.Context, d repository.DueDelivery) {
+	cfg := app.config.webhooks
+
+	start := time.Now()
+	status, err := app.webhooks.Send(ctx, webhook.Request{
+		URL:        d.URL,
+		Secret:     d.Secret,
+		DeliveryID: d.ID,
+		Event:      d.EventType,
+		Payload:    d.Payload,
+	})
+
+	attempt := repository.WebhookAttempt{
+		Duration:    time.Since(start).Milliseconds(),
+		AttemptedAt: start,
+	}
+
+	if status != 0 {
+		attempt.StatusCode = &status
+	}
+
+	var next *time.Time
+	if err != nil {
+		msg := err.Error()
+		attempt.Error = &msg
+
+		if attempts := d.AttemptCount + 1; attempts < cfg.maxAttempts {
+			at := time.Now().Add(webhook.Backoff(cfg.backoff, attempts))
+			next = &at
+		}
+	}
+
+	disabled, err := app.store.Webhooks.RecordAttempt(ctx, d, attempt, next, cfg.disableAfter)
+	if err != nil {
+		app.logger.Errorw("error recording webhook attempt", "delivery_id", d.ID, "error", err)
+		return
+	}
+
+	if disabled {
+		app.logger.Warnw("webhook disabled after repeated failures", "webhook_id", d.WebhookID)
+	}
+}
+
+func (app *app) purgeWebhookDeliveries(ctx context.Context) error {
+	purged, err := app.store.Webhooks.PurgeDeliveries(ctx, time.Now().Add(-app.config.webhooks.retention))
+	if err != nil {
+		return err
+	}
+
+	if purged > 0 {
+		app.logger.Infow("webhook deliveries purged", "count", purged)
+	}
+
+	return nil
+}
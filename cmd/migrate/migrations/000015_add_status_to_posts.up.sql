@@ -0,0 +1,8 @@
+ALTER TABLE posts
+ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'published',
+ADD COLUMN publish_at TIMESTAMP(0) WITH TIME ZONE;
+
+ALTER TABLE posts
+ADD CONSTRAINT posts_status_check CHECK (status IN ('draft', 'scheduled', 'published'));
+
+CREATE INDEX idx_posts_scheduled ON posts (publish_at) WHERE status = 'scheduled';
@@ -0,0 +1,5 @@
+ALTER TABLE posts
+ADD COLUMN deleted_at TIMESTAMP(0) WITH TIME ZONE,
+ADD COLUMN deleted_by BIGINT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_posts_deleted_at ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
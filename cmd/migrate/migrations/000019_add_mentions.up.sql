@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS mentions (
+    id BIGSERIAL PRIMARY KEY,
+    post_id BIGINT,
+    comment_id BIGINT,
+    user_id BIGINT NOT NULL,
+    author_id BIGINT NOT NULL,
+    start_offset INT NOT NULL,
+    end_offset INT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_mention_post FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    CONSTRAINT fk_mention_comment FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+    CONSTRAINT fk_mention_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_mention_author FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT mentions_single_target CHECK ((post_id IS NULL) <> (comment_id IS NULL))
+);
+
+CREATE INDEX idx_mentions_user_id ON mentions (user_id);
+CREATE INDEX idx_mentions_post_id ON mentions (post_id);
+CREATE INDEX idx_mentions_comment_id ON mentions (comment_id);
@@ -0,0 +1 @@
+-- the tag normalization can't be reverted
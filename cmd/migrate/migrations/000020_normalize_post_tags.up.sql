@@ -0,0 +1,2 @@
+-- existing tags are normalized by the API at startup with entities.NormalizeTag,
+-- which SQL can't reproduce, see normalizeLegacyTags
@@ -0,0 +1 @@
+CREATE INDEX idx_posts_content ON posts USING gin (content gin_trgm_ops);
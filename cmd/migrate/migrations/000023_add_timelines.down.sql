@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS followers_counts ON followers;
+
+DROP FUNCTION IF EXISTS update_follow_counts;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS followers_count,
+DROP COLUMN IF EXISTS following_count;
+
+DROP TABLE IF EXISTS timelines;
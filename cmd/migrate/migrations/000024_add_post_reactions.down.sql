@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comments_user_id_created_at;
+
+DROP TABLE IF EXISTS post_reactions;
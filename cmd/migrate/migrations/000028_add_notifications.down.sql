@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS notification_actors;
+
+DROP TABLE IF EXISTS notifications;
+
+DROP INDEX IF EXISTS idx_comments_parent_id;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_id;
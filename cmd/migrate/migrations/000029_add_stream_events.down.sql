@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS stream_events_notify ON stream_events;
+
+DROP FUNCTION IF EXISTS notify_stream_event;
+
+DROP TABLE IF EXISTS stream_events;
@@ -0,0 +1,32 @@
+-- events pushed to connected clients, kept for a while so reconnecting clients
+-- can resume from the last one they saw
+CREATE TABLE IF NOT EXISTS stream_events (
+    id BIGSERIAL PRIMARY KEY,
+    topic VARCHAR(50) NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    actor_id BIGINT NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stream_events_topic_id ON stream_events (topic, id);
+CREATE INDEX IF NOT EXISTS idx_stream_events_created_at ON stream_events (created_at);
+
+-- every API instance listens on stream_events, events too large for a NOTIFY
+-- payload only carry their id and are read back from the table
+CREATE OR REPLACE FUNCTION notify_stream_event() RETURNS TRIGGER AS $$
+DECLARE
+    payload TEXT := row_to_json(NEW)::TEXT;
+BEGIN
+    IF octet_length(payload) > 7900 THEN
+        payload := json_build_object('id', NEW.id)::TEXT;
+    END IF;
+
+    PERFORM pg_notify('stream_events', payload);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER stream_events_notify
+AFTER INSERT ON stream_events
+FOR EACH ROW EXECUTE FUNCTION notify_stream_event();
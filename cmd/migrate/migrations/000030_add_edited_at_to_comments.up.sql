@@ -0,0 +1 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP(0) WITH TIME ZONE;
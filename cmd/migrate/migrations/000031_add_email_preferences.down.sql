@@ -0,0 +1,5 @@
+ALTER TABLE notifications DROP COLUMN IF EXISTS emailed_at;
+
+DROP TABLE IF EXISTS email_digests;
+
+DROP TABLE IF EXISTS email_preferences;
@@ -0,0 +1,19 @@
+-- kinds without a row are not mailed, users opt in to the emails they want
+CREATE TABLE IF NOT EXISTS email_preferences (
+    user_id BIGINT NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    mode VARCHAR(10) NOT NULL CHECK (mode IN ('immediate', 'daily', 'weekly', 'off')),
+    PRIMARY KEY (user_id, kind),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS email_digests (
+    user_id BIGINT NOT NULL,
+    frequency VARCHAR(10) NOT NULL,
+    sent_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (user_id, frequency),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- a notification coalescing new actors after it was mailed is mailed again
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS emailed_at TIMESTAMP(0) WITH TIME ZONE;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS messages;
+
+DROP TABLE IF EXISTS conversation_members;
+
+DROP TABLE IF EXISTS conversations;
+
+ALTER TABLE users DROP COLUMN IF EXISTS dm_followers_only;
@@ -0,0 +1,3 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS pinned_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_posts_pinned ON posts (user_id, pinned_at DESC) WHERE pinned_at IS NOT NULL;
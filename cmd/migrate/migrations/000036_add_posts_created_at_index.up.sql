@@ -0,0 +1,2 @@
+-- trending tags scan the posts of a sliding window across all authors
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at);
@@ -0,0 +1,3 @@
+-- NULL for posts written before explicit tags were kept apart from hashtags,
+-- the API fills them in at startup
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS explicit_tags VARCHAR(100) [];
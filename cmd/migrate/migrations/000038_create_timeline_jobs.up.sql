@@ -0,0 +1,14 @@
+-- the fan-out work of the timelines waits here until a worker has done it, post_id
+-- is set for fan-outs and follower_id for backfills and removals
+CREATE TABLE IF NOT EXISTS timeline_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('fan_out', 'backfill', 'remove')),
+    author_id BIGINT NOT NULL,
+    post_id BIGINT,
+    follower_id BIGINT,
+    attempts INT NOT NULL DEFAULT 0,
+    run_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_timeline_jobs_run_at ON timeline_jobs (run_at, id);
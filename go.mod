@@ -4,7 +4,11 @@ go 1.23.0
 
 toolchain go1.24.1
 
-require github.com/golang-migrate/migrate/v4 v4.18.2
+require (
+	github.com/golang-migrate/migrate/v4 v4.18.2
+	github.com/gorilla/websocket v1.5.3
+	golang.org/x/time v0.9.0
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
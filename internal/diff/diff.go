@@ -0,0 +1,91 @@
+package diff
+
+import "unicode"
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+type Chunk struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Words returns the word level changes that turn a into b. Whitespace is kept
+// as its own token so joining the chunks of b gives back the original text.
+func Words(a, b string) []Chunk {
+	return compute(tokenize(a), tokenize(b))
+}
+
+func tokenize(s string) []string {
+	var tokens []string
+
+	start := 0
+	runes := []rune(s)
+	for i := 1; i <= len(runes); i++ {
+		if i == len(runes) || unicode.IsSpace(runes[i]) != unicode.IsSpace(runes[i-1]) {
+			tokens = append(tokens, string(runes[start:i]))
+			start = i
+		}
+	}
+
+	return tokens
+}
+
+// compute walks the longest common subsequence of a and b.
+func compute(a, b []string) []Chunk {
+	n, m := len(a), len(b)
+
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	chunks := []Chunk{}
+	push := func(op Op, text string) {
+		if last := len(chunks) - 1; last >= 0 && chunks[last].Op == op {
+			chunks[last].Text += text
+			return
+		}
+		chunks = append(chunks, Chunk{Op: op, Text: text})
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			push(Equal, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			push(Delete, a[i])
+			i++
+		default:
+			push(Insert, b[j])
+			j++
+		}
+	}
+
+	for ; i < n; i++ {
+		push(Delete, a[i])
+	}
+	for ; j < m; j++ {
+		push(Insert, b[j])
+	}
+
+	return chunks
+}
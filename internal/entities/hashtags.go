@@ -0,0 +1,98 @@
+package entities
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxTagLength matches the VARCHAR(100) of posts.tags.
+const MaxTagLength = 100
+
+// Hashtag is a #tag found in a piece of text. Tag is normalized, Start and End
+// are offsets in unicode code points covering the original token, including the #.
+type Hashtag struct {
+	Tag   string
+	Start int
+	End   int
+}
+
+// ParseHashtags returns the #tags in text in the order they appear. Like
+// mentions, a # only starts a tag when it isn't glued to a previous word.
+func ParseHashtags(text string) []Hashtag {
+	var hashtags []Hashtag
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' || (i > 0 && isTagRune(runes[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isTagRune(runes[end]) {
+			end++
+		}
+
+		tag := NormalizeTag(string(runes[i+1 : end]))
+		if tag != "" {
+			hashtags = append(hashtags, Hashtag{Tag: tag, Start: i, End: end})
+		}
+		i = end - 1
+	}
+
+	return hashtags
+}
+
+// NormalizeTag folds tag into its canonical form: NFKC normalized, lower case,
+// without the leading #. It returns an empty string for tags that aren't valid.
+func NormalizeTag(tag string) string {
+	tag = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	tag = strings.ToLower(norm.NFKC.String(tag))
+
+	hasLetter := false
+	for _, r := range tag {
+		if !isTagRune(r) {
+			return ""
+		}
+		if !unicode.IsDigit(r) {
+			hasLetter = true
+		}
+	}
+
+	// tags made only of digits are usually issue numbers or rankings, not topics
+	if !hasLetter || len([]rune(tag)) > MaxTagLength {
+		return ""
+	}
+
+	return tag
+}
+
+// MergeTags normalizes the explicit tags and adds the hashtags found in content,
+// dropping invalid entries and duplicates while keeping the first occurrence order.
+func MergeTags(explicit []string, content string) []string {
+	tags := []string{}
+	seen := make(map[string]bool)
+
+	add := func(tag string) {
+		if tag == "" || seen[tag] {
+			return
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	for _, tag := range explicit {
+		add(NormalizeTag(tag))
+	}
+
+	for _, hashtag := range ParseHashtags(content) {
+		add(hashtag.Tag)
+	}
+
+	return tags
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_'
+}
@@ -0,0 +1,90 @@
+package entities
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseHashtags(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Hashtag
+	}{
+		{"no hashtags", "hello there", nil},
+		{"at the start", "#go rocks", []Hashtag{{"go", 0, 3}}},
+		{"normalized", "I like #Go", []Hashtag{{"go", 7, 10}}},
+		{"full width letters", "#ＧＯ", []Hashtag{{"go", 0, 3}}},
+		{"accents are kept", "#Café", []Hashtag{{"café", 0, 5}}},
+		{"a dash ends the tag", "#go-lang", []Hashtag{{"go", 0, 3}}},
+		{"glued to a word", "C# and a#b", nil},
+		{"digits only", "issue #123", nil},
+		{"digits and letters", "#web3", []Hashtag{{"web3", 0, 5}}},
+		{"repeated tags are all returned", "#go #go", []Hashtag{{"go", 0, 3}, {"go", 4, 7}}},
+		{"offsets count code points", "héé #go", []Hashtag{{"go", 4, 7}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseHashtags(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"go", "go"},
+		{"Go", "go"},
+		{"#Go", "go"},
+		{"  #Go  ", "go"},
+		{"ＧＯ", "go"},
+		{"snake_case", "snake_case"},
+		{"web3", "web3"},
+		{"123", ""},
+		{"Go Lang", ""},
+		{"go-lang", ""},
+		{"c++", ""},
+		{"", ""},
+		{"#", ""},
+		{strings.Repeat("a", MaxTagLength), strings.Repeat("a", MaxTagLength)},
+		{strings.Repeat("a", MaxTagLength+1), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := NormalizeTag(tt.tag); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		explicit []string
+		content  string
+		want     []string
+	}{
+		{"nothing", nil, "", []string{}},
+		{"explicit tags are normalized and deduplicated", []string{"Go", "go", "#GO"}, "", []string{"go"}},
+		{"hashtags come after the explicit tags", []string{"sql"}, "about #go and #sql", []string{"sql", "go"}},
+		{"invalid explicit tags are dropped", []string{"bad tag", "42"}, "#Rust", []string{"rust"}},
+		{"hashtags alone", nil, "#b then #a then #b", []string{"b", "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeTags(tt.explicit, tt.content)
+			if got == nil || !slices.Equal(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
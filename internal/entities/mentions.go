@@ -0,0 +1,55 @@
+package entities
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Mention is an @username found in a piece of text. Start and End are offsets
+// in unicode code points and cover the whole token, including the @.
+type Mention struct {
+	Username string
+	Start    int
+	End      int
+}
+
+// ParseMentions returns the @usernames in text in the order they appear.
+// An @ only starts a mention at the beginning of the text or after a character
+// that can't be part of a username, so email addresses are skipped.
+func ParseMentions(text string) []Mention {
+	var mentions []Mention
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' || (i > 0 && isUsernameRune(runes[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isUsernameRune(runes[end]) {
+			end++
+		}
+
+		// a trailing dot or dash is punctuation, not part of the name
+		for end > i+1 && strings.ContainsRune(".-", runes[end-1]) {
+			end--
+		}
+
+		if end == i+1 {
+			continue
+		}
+
+		mentions = append(mentions, Mention{
+			Username: string(runes[i+1 : end]),
+			Start:    i,
+			End:      end,
+		})
+		i = end - 1
+	}
+
+	return mentions
+}
+
+func isUsernameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-'
+}
@@ -0,0 +1,37 @@
+package entities
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Mention
+	}{
+		{"no mentions", "hello there", nil},
+		{"at the start", "@alice hi", []Mention{{"alice", 0, 6}}},
+		{"after a space", "hi @alice", []Mention{{"alice", 3, 9}}},
+		{"several", "@alice and @bob", []Mention{{"alice", 0, 6}, {"bob", 11, 15}}},
+		{"inside punctuation", "(@carol)", []Mention{{"carol", 1, 7}}},
+		{"a trailing dot is punctuation", "thanks @bob.", []Mention{{"bob", 7, 11}}},
+		{"a trailing dash is punctuation", "@al-ice-", []Mention{{"al-ice", 0, 7}}},
+		{"dots inside the name are kept", "@john.doe", []Mention{{"john.doe", 0, 9}}},
+		{"email addresses are skipped", "mail a@b.com", nil},
+		{"a bare @", "@ alone", nil},
+		{"only punctuation after the @", "@.-", nil},
+		{"a mention glued to another one", "@a@b", []Mention{{"a", 0, 2}}},
+		{"offsets count code points", "héé @bob", []Mention{{"bob", 4, 8}}},
+		{"non ascii names", "@zoë!", []Mention{{"zoë", 0, 4}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseMentions(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+// Package events hands what happens in the API off to the subsystems that react
+// to it, such as notifications, outside of the request that caused it.
+package events
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	PostCreated    = "post.created"
+	CommentCreated = "comment.created"
+	CommentUpdated = "comment.updated"
+	CommentDeleted = "comment.deleted"
+	UserFollowed   = "user.followed"
+	PostReacted    = "post.reacted"
+)
+
+// Event is something ActorID did. Which of the other ids are set depends on Type:
+// PostID for posts, PostID and CommentID for comments, UserID for the followed
+// user and PostID and Kind for reactions.
+type Event struct {
+	Type      string    `json:"type"`
+	ActorID   int64     `json:"actor_id"`
+	UserID    int64     `json:"user_id,omitempty"`
+	PostID    int64     `json:"post_id,omitempty"`
+	CommentID int64     `json:"comment_id,omitempty"`
+	Kind      string    `json:"kind,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Handler reacts to an event, errors are reported to the bus' error handler and
+// the event is not retried.
+type Handler func(context.Context, Event) error
+
+type subscription struct {
+	name    string
+	types   map[string]bool
+	handler Handler
+	// sync handlers run in Publish instead of on the workers
+	sync bool
+}
+
+// Bus queues published events and runs them through the subscribed handlers on
+// its workers, the sync ones excepted.
+type Bus struct {
+	queue   chan Event
+	onError func(e Event, subscriber string, err error)
+	onDrop  func(e Event, dropped int64)
+	dropped atomic.Int64
+
+	mu            sync.RWMutex
+	subscriptions []subscription
+}
+
+// NewBus returns a bus queueing up to queueSize events. onDrop is called with
+// the events that didn't fit and how many were dropped so far.
+func NewBus(queueSize int, onError func(e Event, subscriber string, err error), onDrop func(e Event, dropped int64)) *Bus {
+	return &Bus{
+		queue:   make(chan Event, queueSize),
+		onError: onError,
+		onDrop:  onDrop,
+	}
+}
+
+// Subscribe has handler called with the events of the given types, or with
+// every event when no type is given. name identifies it in error reports.
+func (b *Bus) Subscribe(name string, handler Handler, types ...string) {
+	b.subscribe(subscription{name: name, handler: handler}, types)
+}
+
+// SubscribeSync is like Subscribe but handler is called by Publish itself, before
+// it returns. It is for the handlers that only record what has to be done later,
+// which mustn't be lost when the queue is full or the process stops.
+func (b *Bus) SubscribeSync(name string, handler Handler, types ...string) {
+	b.subscribe(subscription{name: name, handler: handler, sync: true}, types)
+}
+
+func (b *Bus) subscribe(s subscription, types []string) {
+	if len(types) > 0 {
+		s.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscriptions = append(b.subscriptions, s)
+}
+
+// Publish runs e through the sync handlers, then queues it for the others and
+// reports whether it did. It never waits for the queue, publishers are requests
+// that shouldn't be held up by slow subscribers, so e is dropped for the queued
+// handlers when the queue is full.
+func (b *Bus) Publish(ctx context.Context, e Event) bool {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+
+	// what they record has to be saved even when the request is cancelled
+	b.dispatch(context.WithoutCancel(ctx), e, true)
+
+	select {
+	case b.queue <- e:
+		return true
+	default:
+		dropped := b.dropped.Add(1)
+		if b.onDrop != nil {
+			b.onDrop(e, dropped)
+		}
+		return false
+	}
+}
+
+// Dropped returns how many events were dropped because the queue was full.
+func (b *Bus) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+// Run starts workers goroutines handling queued events until ctx is cancelled.
+func (b *Bus) Run(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		go b.work(ctx)
+	}
+}
+
+func (b *Bus) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-b.queue:
+			b.dispatch(ctx, e, false)
+		}
+	}
+}
+
+// dispatch calls the handlers subscribed to e, the sync ones or the others.
+func (b *Bus) dispatch(ctx context.Context, e Event, sync bool) {
+	b.mu.RLock()
+	subscriptions := b.subscriptions
+	b.mu.RUnlock()
+
+	for _, s := range subscriptions {
+		if s.sync != sync || (s.types != nil && !s.types[e.Type]) {
+			continue
+		}
+
+		if err := s.handler(ctx, e); err != nil && b.onError != nil {
+			b.onError(e, s.name, err)
+		}
+	}
+}
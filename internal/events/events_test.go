@@ -0,0 +1,89 @@
+package events
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPublish(t *testing.T) {
+	var dropped []int64
+	b := NewBus(1, nil, func(e Event, n int64) { dropped = append(dropped, n) })
+
+	var synced []string
+	b.SubscribeSync("sync", func(ctx context.Context, e Event) error {
+		if ctx.Err() != nil {
+			t.Errorf("sync handler called with a cancelled context")
+		}
+		synced = append(synced, e.Type)
+		return nil
+	}, PostCreated, UserFollowed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		event  Event
+		queued bool
+		synced []string
+	}{
+		{"queued and handled in place", Event{Type: PostCreated}, true, []string{PostCreated}},
+		{"other types aren't handled in place", Event{Type: CommentCreated}, false, []string{PostCreated}},
+		{"handled in place when the queue is full", Event{Type: UserFollowed}, false, []string{PostCreated, UserFollowed}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if queued := b.Publish(ctx, tt.event); queued != tt.queued {
+				t.Errorf("queued: got %v, want %v", queued, tt.queued)
+			}
+
+			if !slices.Equal(synced, tt.synced) {
+				t.Errorf("handled in place: got %v, want %v", synced, tt.synced)
+			}
+		})
+	}
+
+	if want := []int64{1, 2}; !slices.Equal(dropped, want) || b.Dropped() != 2 {
+		t.Errorf("dropped: got %v and %d, want %v", dropped, b.Dropped(), want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	b := NewBus(10, nil, nil)
+
+	handled := make(chan Event, 10)
+	b.Subscribe("queued", func(ctx context.Context, e Event) error {
+		handled <- e
+		return nil
+	}, CommentCreated)
+
+	var synced int
+	b.SubscribeSync("sync", func(ctx context.Context, e Event) error {
+		synced++
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.Run(ctx, 2)
+
+	b.Publish(ctx, Event{Type: PostCreated})
+	b.Publish(ctx, Event{Type: CommentCreated, CommentID: 7})
+
+	select {
+	case e := <-handled:
+		if e.CommentID != 7 || e.At.IsZero() {
+			t.Errorf("got %+v, want the comment with its time set", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the queued handler wasn't called")
+	}
+
+	// sync handlers are not run again by the workers
+	if synced != 2 {
+		t.Errorf("sync handler called %d times, want 2", synced)
+	}
+}
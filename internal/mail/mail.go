@@ -6,6 +6,11 @@ const (
 	FromName            = "GopherSocial"
 	maxRetries          = 3
 	UserWelcomeTemplate = "user_invitation.tmpl"
+
+	// NotificationTemplate mails a single notification as it happens and
+	// DigestTemplate sums up the unread ones, both end with an unsubscribe link.
+	NotificationTemplate = "notification.tmpl"
+	DigestTemplate       = "digest.tmpl"
 )
 
 //go:embed templates/*
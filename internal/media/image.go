@@ -0,0 +1,103 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+// MaxPixels guards against decompression bombs, bigger images are rejected before decoding.
+const MaxPixels = 50_000_000
+
+var ErrImageTooLarge = errors.New("image dimensions are too large")
+
+type Image struct {
+	Width     int
+	Height    int
+	Thumbnail []byte
+}
+
+// Process reads the dimensions of the image in r and renders a JPEG thumbnail
+// that fits in a thumbSize x thumbSize box. Images are never upscaled.
+func Process(r io.ReadSeeker, thumbSize int) (*Image, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, resize(src, thumbSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		Width:     cfg.Width,
+		Height:    cfg.Height,
+		Thumbnail: buf.Bytes(),
+	}, nil
+}
+
+// resize downsamples src with a box filter, every destination pixel is the
+// average of the source pixels it covers.
+func resize(src image.Image, maxSize int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if w > maxSize || h > maxSize {
+		if w >= h {
+			w, h = maxSize, max(1, h*maxSize/w)
+		} else {
+			w, h = max(1, w*maxSize/h), maxSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy0 := b.Min.Y + y*b.Dy()/h
+		sy1 := max(sy0+1, b.Min.Y+(y+1)*b.Dy()/h)
+
+		for x := 0; x < w; x++ {
+			sx0 := b.Min.X + x*b.Dx()/w
+			sx1 := max(sx0+1, b.Min.X+(x+1)*b.Dx()/w)
+
+			var sr, sg, sb, sa, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					r, g, b, a := src.At(sx, sy).RGBA()
+					sr, sg, sb, sa = sr+uint64(r), sg+uint64(g), sb+uint64(b), sa+uint64(a)
+					n++
+				}
+			}
+
+			// JPEG has no alpha channel so transparent areas are flattened onto white
+			bg := 0xffff - sa/n
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(sr/n + bg),
+				G: uint16(sg/n + bg),
+				B: uint16(sb/n + bg),
+				A: 0xffff,
+			})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,124 @@
+// Package ranking orders feed candidates by relevance instead of recency alone.
+package ranking
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Candidate is a post eligible for a ranked feed along with the signals the
+// scorers look at.
+type Candidate struct {
+	PostID    int64
+	AuthorID  int64
+	CreatedAt time.Time
+	// Degree is 0 for the viewer's own posts, 1 for accounts they follow and 2 for
+	// accounts followed by those.
+	Degree    int
+	Comments  int
+	Reactions int
+	// Affinity counts the viewer's recent comments and reactions on the author's posts.
+	Affinity int
+}
+
+// Scorer gives a candidate a relevance score, higher ranks first. Scores only
+// need to be comparable within the same call to Rank.
+type Scorer interface {
+	Score(c Candidate, now time.Time) float64
+}
+
+// Rank returns candidates sorted by descending score as of now. Ties go to the
+// newer post and then the higher id, so the same input always ranks the same way.
+func Rank(s Scorer, candidates []Candidate, now time.Time) []Candidate {
+	type scored struct {
+		Candidate
+		score float64
+	}
+
+	all := make([]scored, len(candidates))
+	for i, c := range candidates {
+		all[i] = scored{c, s.Score(c, now)}
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		switch {
+		case a.score != b.score:
+			return a.score > b.score
+		case !a.CreatedAt.Equal(b.CreatedAt):
+			return a.CreatedAt.After(b.CreatedAt)
+		default:
+			return a.PostID > b.PostID
+		}
+	})
+
+	ranked := make([]Candidate, len(all))
+	for i, c := range all {
+		ranked[i] = c.Candidate
+	}
+
+	return ranked
+}
+
+// ByName returns the scorer configured under name.
+func ByName(name string) (Scorer, bool) {
+	switch name {
+	case "recency":
+		return Recency{HalfLife: DefaultEngagement.HalfLife}, true
+	case "engagement":
+		return DefaultEngagement, true
+	default:
+		return nil, false
+	}
+}
+
+// Recency ranks by age alone, halving a post's score every HalfLife.
+type Recency struct {
+	HalfLife time.Duration
+}
+
+func (r Recency) Score(c Candidate, now time.Time) float64 {
+	return decay(now.Sub(c.CreatedAt), r.HalfLife)
+}
+
+// Engagement boosts the recency decay with the post's comments and reactions and
+// with how much the viewer interacts with its author. Counts are dampened with a
+// logarithm so a viral post doesn't drown everything else.
+type Engagement struct {
+	HalfLife       time.Duration
+	CommentWeight  float64
+	ReactionWeight float64
+	AffinityWeight float64
+	// SecondDegreeWeight scales posts from accounts the viewer doesn't follow.
+	SecondDegreeWeight float64
+}
+
+var DefaultEngagement = Engagement{
+	HalfLife:           time.Hour * 12,
+	CommentWeight:      1,
+	ReactionWeight:     0.5,
+	AffinityWeight:     1,
+	SecondDegreeWeight: 0.5,
+}
+
+func (e Engagement) Score(c Candidate, now time.Time) float64 {
+	score := decay(now.Sub(c.CreatedAt), e.HalfLife)
+	score *= 1 + e.CommentWeight*math.Log1p(float64(c.Comments)) + e.ReactionWeight*math.Log1p(float64(c.Reactions))
+	score *= 1 + e.AffinityWeight*math.Log1p(float64(c.Affinity))
+
+	if c.Degree > 1 {
+		score *= e.SecondDegreeWeight
+	}
+
+	return score
+}
+
+// decay halves every halfLife, posts from the future count as brand new.
+func decay(age, halfLife time.Duration) float64 {
+	if age < 0 {
+		age = 0
+	}
+
+	return math.Exp2(-float64(age) / float64(halfLife))
+}
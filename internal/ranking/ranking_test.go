@@ -0,0 +1,195 @@
+package ranking
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2025, time.January, 10, 12, 0, 0, 0, time.UTC)
+
+// bare is the engagement scorer with every boost switched off, only the decay is left.
+var bare = Engagement{HalfLife: time.Hour * 12, SecondDegreeWeight: 1}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestScore(t *testing.T) {
+	post := func(age time.Duration) Candidate {
+		return Candidate{PostID: 1, AuthorID: 2, CreatedAt: now.Add(-age), Degree: 1}
+	}
+
+	tests := []struct {
+		name   string
+		scorer Scorer
+		c      Candidate
+		want   float64
+	}{
+		{"recency of a new post", Recency{HalfLife: time.Hour}, post(0), 1},
+		{"recency after a half life", Recency{HalfLife: time.Hour}, post(time.Hour), 0.5},
+		{"recency after two half lives", Recency{HalfLife: time.Hour}, post(2 * time.Hour), 0.25},
+		{"posts from the future count as new", Recency{HalfLife: time.Hour}, post(-time.Hour), 1},
+		{"decay alone", bare, post(12 * time.Hour), 0.5},
+		{
+			name:   "comments",
+			scorer: Engagement{HalfLife: time.Hour, CommentWeight: 2, SecondDegreeWeight: 1},
+			c:      Candidate{CreatedAt: now, Degree: 1, Comments: 3},
+			want:   1 + 2*math.Log1p(3),
+		},
+		{
+			name:   "reactions",
+			scorer: Engagement{HalfLife: time.Hour, ReactionWeight: 0.5, SecondDegreeWeight: 1},
+			c:      Candidate{CreatedAt: now, Degree: 1, Reactions: 7},
+			want:   1 + 0.5*math.Log1p(7),
+		},
+		{
+			name:   "comments and reactions add up",
+			scorer: Engagement{HalfLife: time.Hour, CommentWeight: 1, ReactionWeight: 0.5, SecondDegreeWeight: 1},
+			c:      Candidate{CreatedAt: now, Degree: 1, Comments: 1, Reactions: 1},
+			want:   1 + 1.5*math.Log1p(1),
+		},
+		{
+			name:   "affinity multiplies engagement",
+			scorer: Engagement{HalfLife: time.Hour, CommentWeight: 1, AffinityWeight: 1, SecondDegreeWeight: 1},
+			c:      Candidate{CreatedAt: now, Degree: 1, Comments: 1, Affinity: 4},
+			want:   (1 + math.Log1p(1)) * (1 + math.Log1p(4)),
+		},
+		{
+			name:   "engagement decays with age",
+			scorer: Engagement{HalfLife: time.Hour, CommentWeight: 1, SecondDegreeWeight: 1},
+			c:      Candidate{CreatedAt: now.Add(-time.Hour), Degree: 1, Comments: 1},
+			want:   0.5 * (1 + math.Log1p(1)),
+		},
+		{
+			name:   "second degree posts are penalized",
+			scorer: DefaultEngagement,
+			c:      Candidate{CreatedAt: now, Degree: 2},
+			want:   DefaultEngagement.SecondDegreeWeight,
+		},
+		{
+			name:   "own posts are not penalized",
+			scorer: DefaultEngagement,
+			c:      Candidate{CreatedAt: now, Degree: 0},
+			want:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scorer.Score(tt.c, now); !approx(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	ids := func(candidates []Candidate) []int64 {
+		var ids []int64
+		for _, c := range candidates {
+			ids = append(ids, c.PostID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name       string
+		scorer     Scorer
+		candidates []Candidate
+		want       []int64
+	}{
+		{
+			name:   "newer first by recency",
+			scorer: Recency{HalfLife: time.Hour},
+			candidates: []Candidate{
+				{PostID: 1, CreatedAt: now.Add(-3 * time.Hour)},
+				{PostID: 2, CreatedAt: now.Add(-time.Hour)},
+				{PostID: 3, CreatedAt: now.Add(-2 * time.Hour)},
+			},
+			want: []int64{2, 3, 1},
+		},
+		{
+			name:   "engagement outranks a slightly newer post",
+			scorer: DefaultEngagement,
+			candidates: []Candidate{
+				{PostID: 1, CreatedAt: now.Add(-time.Hour), Degree: 1},
+				{PostID: 2, CreatedAt: now.Add(-2 * time.Hour), Degree: 1, Comments: 10, Reactions: 20},
+			},
+			want: []int64{2, 1},
+		},
+		{
+			name:   "the author the viewer interacts with first",
+			scorer: DefaultEngagement,
+			candidates: []Candidate{
+				{PostID: 1, AuthorID: 10, CreatedAt: now, Degree: 1},
+				{PostID: 2, AuthorID: 20, CreatedAt: now, Degree: 1, Affinity: 5},
+			},
+			want: []int64{2, 1},
+		},
+		{
+			name:   "followed accounts before second degree ones",
+			scorer: DefaultEngagement,
+			candidates: []Candidate{
+				{PostID: 1, CreatedAt: now, Degree: 2},
+				{PostID: 2, CreatedAt: now, Degree: 1},
+			},
+			want: []int64{2, 1},
+		},
+		{
+			name:   "equal scores go to the newer post",
+			scorer: Engagement{HalfLife: time.Hour, SecondDegreeWeight: 1},
+			candidates: []Candidate{
+				// both are from the future so they score 1
+				{PostID: 1, CreatedAt: now.Add(time.Minute)},
+				{PostID: 2, CreatedAt: now.Add(2 * time.Minute)},
+			},
+			want: []int64{2, 1},
+		},
+		{
+			name:   "equal scores and times go to the higher id",
+			scorer: bare,
+			candidates: []Candidate{
+				{PostID: 5, CreatedAt: now},
+				{PostID: 9, CreatedAt: now},
+				{PostID: 7, CreatedAt: now},
+			},
+			want: []int64{9, 7, 5},
+		},
+		{
+			name:       "nothing to rank",
+			scorer:     DefaultEngagement,
+			candidates: nil,
+			want:       nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(Rank(tt.scorer, tt.candidates, now))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			// the same candidates in another order rank the same way
+			reversed := slices.Clone(tt.candidates)
+			slices.Reverse(reversed)
+			if again := ids(Rank(tt.scorer, reversed, now)); !slices.Equal(again, tt.want) {
+				t.Errorf("reversed input: got %v, want %v", again, tt.want)
+			}
+		})
+	}
+}
+
+func TestByName(t *testing.T) {
+	for _, name := range []string{"recency", "engagement"} {
+		if _, ok := ByName(name); !ok {
+			t.Errorf("%s is not a scorer", name)
+		}
+	}
+
+	if _, ok := ByName("random"); ok {
+		t.Error("random is a scorer")
+	}
+}
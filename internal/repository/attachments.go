@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+type Attachment struct {
+	ID           int64   `json:"id"`
+	PostID       int64   `json:"post_id"`
+	UserID       int64   `json:"user_id"`
+	FileName     string  `json:"file_name"`
+	MimeType     string  `json:"mime_type"`
+	Size         int64   `json:"size"`
+	Width        *int    `json:"width,omitempty"`
+	Height       *int    `json:"height,omitempty"`
+	StorageKey   string  `json:"-"`
+	ThumbnailKey *string `json:"-"`
+	URL          string  `json:"url"`
+	ThumbnailURL string  `json:"thumbnail_url,omitempty"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+type PostgresAttachmentsStore struct {
+	db *sql.DB
+}
+
+var ErrorTooManyAttachments = errors.New("the post has too many attachments")
+
+// Create adds attachments to the post they belong to, all of them or none. It
+// fails with ErrorTooManyAttachments when the post would end up with more than
+// max, the post row is locked meanwhile so concurrent uploads can't both pass.
+func (s *PostgresAttachmentsStore) Create(ctx context.Context, postId int64, attachments []*Attachment, max int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `SELECT 1 FROM posts WHERE id = $1 FOR UPDATE`, postId); err != nil {
+			return err
+		}
+
+		var count int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM post_attachments WHERE post_id = $1`, postId).Scan(&count); err != nil {
+			return err
+		}
+
+		if count+len(attachments) > max {
+			return ErrorTooManyAttachments
+		}
+
+		query := `
+		INSERT INTO post_attachments (post_id, user_id, file_name, mime_type, size_bytes, width, height, storage_key, thumbnail_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at
+		`
+
+		for _, a := range attachments {
+			err := tx.QueryRowContext(
+				ctx,
+				query,
+				postId,
+				a.UserID,
+				a.FileName,
+				a.MimeType,
+				a.Size,
+				a.Width,
+				a.Height,
+				a.StorageKey,
+				a.ThumbnailKey,
+			).Scan(&a.ID, &a.CreatedAt)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *PostgresAttachmentsStore) GetById(ctx context.Context, id int64) (*Attachment, error) {
+	query := `
+	SELECT id, post_id, user_id, file_name, mime_type, size_bytes, width, height, storage_key, thumbnail_key, created_at
+	FROM post_attachments
+	WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var a Attachment
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&a.ID,
+		&a.PostID,
+		&a.UserID,
+		&a.FileName,
+		&a.MimeType,
+		&a.Size,
+		&a.Width,
+		&a.Height,
+		&a.StorageKey,
+		&a.ThumbnailKey,
+		&a.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &a, nil
+}
+
+// GetByPostIds loads the attachments of several posts at once, keyed by post id.
+func (s *PostgresAttachmentsStore) GetByPostIds(ctx context.Context, postIds []int64) (map[int64][]Attachment, error) {
+	query := `
+	SELECT id, post_id, user_id, file_name, mime_type, size_bytes, width, height, storage_key, thumbnail_key, created_at
+	FROM post_attachments
+	WHERE post_id = ANY($1)
+	ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := make(map[int64][]Attachment)
+	for rows.Next() {
+		var a Attachment
+		err := rows.Scan(
+			&a.ID,
+			&a.PostID,
+			&a.UserID,
+			&a.FileName,
+			&a.MimeType,
+			&a.Size,
+			&a.Width,
+			&a.Height,
+			&a.StorageKey,
+			&a.ThumbnailKey,
+			&a.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments[a.PostID] = append(attachments[a.PostID], a)
+	}
+
+	return attachments, rows.Err()
+}
+
+func (s *PostgresAttachmentsStore) CountByPostId(ctx context.Context, postId int64) (int, error) {
+	query := `SELECT COUNT(*) FROM post_attachments WHERE post_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, query, postId).Scan(&count)
+	return count, err
+}
+
+func (s *PostgresAttachmentsStore) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM post_attachments WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	response, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := response.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
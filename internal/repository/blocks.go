@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// RelatedUser is an account in one of the caller's block or mute lists.
+type RelatedUser struct {
+	ID        int64      `json:"id"`
+	Username  string     `json:"username"`
+	CreatedAt string     `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type PostgresBlocksStore struct {
+	db *sql.DB
+}
+
+// Block makes blockerId and blockedId invisible to each other. Any follow or
+// pending follow request between them, in either direction, is dropped.
+func (s *PostgresBlocksStore) Block(ctx context.Context, blockerId int64, blockedId int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		queries := []string{
+			`INSERT INTO blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT (blocker_id, blocked_id) DO NOTHING`,
+			`DELETE FROM followers WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)`,
+			`DELETE FROM follow_requests WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)`,
+		}
+
+		for _, query := range queries {
+			if _, err := tx.ExecContext(ctx, query, blockerId, blockedId); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Unblock lifts the block of blockerId on blockedId, the follows it dropped stay dropped.
+func (s *PostgresBlocksStore) Unblock(ctx context.Context, blockerId int64, blockedId int64) error {
+	query := `DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, blockerId, blockedId)
+	return err
+}
+
+// Between reports whether either of the two users has blocked the other.
+func (s *PostgresBlocksStore) Between(ctx context.Context, userId int64, otherId int64) (bool, error) {
+	query := `SELECT NOT ` + notBlocked("$1::bigint", "$2::bigint")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var blocked bool
+	err := s.db.QueryRowContext(ctx, query, userId, otherId).Scan(&blocked)
+	return blocked, err
+}
+
+// GetBlockedIds lists the ids of the accounts userId has blocked or was blocked by.
+func (s *PostgresBlocksStore) GetBlockedIds(ctx context.Context, userId int64) ([]int64, error) {
+	query := `
+	SELECT blocked_id FROM blocks WHERE blocker_id = $1
+	UNION
+	SELECT blocker_id FROM blocks WHERE blocked_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetBlocked lists the accounts blockerId has blocked, most recent first.
+func (s *PostgresBlocksStore) GetBlocked(ctx context.Context, blockerId int64, fq PaginatedFeedQuery) ([]RelatedUser, error) {
+	keyset, args := fq.keyset("b.created_at", "b.blocked_id", 4)
+
+	query := `
+	SELECT u.id, u.username, b.created_at
+	FROM blocks b
+	JOIN users u ON u.id = b.blocked_id
+	WHERE b.blocker_id = $1 AND ` + keyset + `
+	ORDER BY b.created_at ` + fq.Sort + `, b.blocked_id ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{blockerId, fq.Limit, fq.Offset}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []RelatedUser{}
+	for rows.Next() {
+		var u RelatedUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+type PostgresMutesStore struct {
+	db *sql.DB
+}
+
+// Mute hides mutedId from the feeds of muterId until expiresAt, or for good when
+// it is nil. Muting again replaces the expiry.
+func (s *PostgresMutesStore) Mute(ctx context.Context, muterId int64, mutedId int64, expiresAt *time.Time) error {
+	query := `
+	INSERT INTO mutes (muter_id, muted_id, expires_at) VALUES ($1, $2, $3)
+	ON CONFLICT (muter_id, muted_id) DO UPDATE SET expires_at = EXCLUDED.expires_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, muterId, mutedId, expiresAt)
+	return err
+}
+
+func (s *PostgresMutesStore) Unmute(ctx context.Context, muterId int64, mutedId int64) error {
+	query := `DELETE FROM mutes WHERE muter_id = $1 AND muted_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, muterId, mutedId)
+	return err
+}
+
+// GetMuted lists the accounts muterId currently mutes, most recent first.
+func (s *PostgresMutesStore) GetMuted(ctx context.Context, muterId int64, fq PaginatedFeedQuery) ([]RelatedUser, error) {
+	keyset, args := fq.keyset("m.created_at", "m.muted_id", 4)
+
+	query := `
+	SELECT u.id, u.username, m.created_at, m.expires_at
+	FROM mutes m
+	JOIN users u ON u.id = m.muted_id
+	WHERE m.muter_id = $1 AND (m.expires_at IS NULL OR m.expires_at > NOW()) AND ` + keyset + `
+	ORDER BY m.created_at ` + fq.Sort + `, m.muted_id ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{muterId, fq.Limit, fq.Offset}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []RelatedUser{}
+	for rows.Next() {
+		var u RelatedUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.CreatedAt, &u.ExpiresAt); err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// PurgeExpired deletes the mutes that have run out, they already stopped applying.
+func (s *PostgresMutesStore) PurgeExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM mutes WHERE expires_at <= NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	response, err := s.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return response.RowsAffected()
+}
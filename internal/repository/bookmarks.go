@@ -0,0 +1,300 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrorDuplicateCollection = errors.New("a collection with this name already exists")
+
+type Bookmark struct {
+	PostID       int64  `json:"post_id"`
+	CollectionID *int64 `json:"collection_id"`
+	CreatedAt    string `json:"created_at"`
+	// Available is false once the post is deleted or its author can no longer be
+	// seen by the user, Post is then left out.
+	Available bool              `json:"available"`
+	Post      *PostWithMetadata `json:"post"`
+}
+
+type BookmarkCollection struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Name      string `json:"name"`
+	Count     int    `json:"bookmarks_count"`
+	CreatedAt string `json:"created_at"`
+}
+
+type PostgresBookmarksStore struct {
+	db *sql.DB
+}
+
+// Set bookmarks postId for userId in collectionId, or outside of any collection
+// when it is nil. Bookmarking a post again moves it to collectionId when move
+// is true and leaves it where it is otherwise.
+func (s *PostgresBookmarksStore) Set(ctx context.Context, userId, postId int64, collectionId *int64, move bool) error {
+	query := `
+	INSERT INTO bookmarks (user_id, post_id, collection_id) VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, post_id) DO UPDATE
+	SET collection_id = CASE WHEN $4 THEN EXCLUDED.collection_id ELSE bookmarks.collection_id END
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userId, postId, collectionId, move)
+	return err
+}
+
+func (s *PostgresBookmarksStore) Remove(ctx context.Context, userId, postId int64) error {
+	query := `DELETE FROM bookmarks WHERE user_id = $1 AND post_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userId, postId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+// Get lists the bookmarks of userId, the most recently saved first, only those
+// of collectionId when it is set. Bookmarks of posts that were deleted, or whose
+// author the user can no longer see, stay listed as unavailable so they can be
+// removed, and come back if the post does. The filters of fq apply to the posts,
+// so a filtered listing only has available bookmarks.
+func (s *PostgresBookmarksStore) Get(ctx context.Context, userId int64, collectionId *int64, fq PaginatedFeedQuery) ([]Bookmark, error) {
+	keyset, args := fq.keyset("b.created_at", "b.post_id", 5)
+	filters, filterArgs := fq.filters("p", 5+len(args))
+	args = append(args, filterArgs...)
+
+	query := `
+	SELECT b.post_id, b.collection_id, b.created_at,
+	p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.edited_at, u.username,
+	(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count
+	FROM bookmarks b
+	LEFT JOIN posts p ON p.id = b.post_id AND p.status = 'published' AND p.deleted_at IS NULL
+	AND ` + visibleAuthor("p.user_id", "$1") + `
+	LEFT JOIN users u ON u.id = p.user_id
+	WHERE b.user_id = $1 AND ($4::bigint IS NULL OR b.collection_id = $4) AND ` + keyset + ` AND ` + filters + `
+	ORDER BY b.created_at ` + fq.Sort + `, b.post_id ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{userId, fq.Limit, fq.Offset, collectionId}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarks := []Bookmark{}
+	for rows.Next() {
+		var b Bookmark
+		var post struct {
+			ID        *int64
+			UserID    *int64
+			Title     *string
+			Content   *string
+			CreatedAt *string
+			Version   *int
+			EditedAt  *time.Time
+			Username  *string
+		}
+		var tags []string
+		var commentCount int
+
+		err := rows.Scan(
+			&b.PostID,
+			&b.CollectionID,
+			&b.CreatedAt,
+			&post.ID,
+			&post.UserID,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&tags),
+			&post.EditedAt,
+			&post.Username,
+			&commentCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if post.ID != nil {
+			b.Available = true
+			b.Post = &PostWithMetadata{
+				Post: Post{
+					ID:        *post.ID,
+					UserId:    *post.UserID,
+					Title:     *post.Title,
+					Content:   *post.Content,
+					CreatedAt: *post.CreatedAt,
+					Version:   *post.Version,
+					Tags:      tags,
+					EditedAt:  post.EditedAt,
+					Edited:    post.EditedAt != nil,
+					User:      User{ID: *post.UserID, Username: *post.Username},
+				},
+				CommentCount: commentCount,
+			}
+		}
+
+		bookmarks = append(bookmarks, b)
+	}
+
+	return bookmarks, rows.Err()
+}
+
+// GetCollections lists the bookmark collections of userId by name, with how
+// many bookmarks each holds.
+func (s *PostgresBookmarksStore) GetCollections(ctx context.Context, userId int64) ([]BookmarkCollection, error) {
+	query := `
+	SELECT bc.id, bc.user_id, bc.name, bc.created_at,
+	(SELECT COUNT(*) FROM bookmarks b WHERE b.collection_id = bc.id)
+	FROM bookmark_collections bc
+	WHERE bc.user_id = $1
+	ORDER BY bc.name, bc.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []BookmarkCollection{}
+	for rows.Next() {
+		var c BookmarkCollection
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt, &c.Count); err != nil {
+			return nil, err
+		}
+
+		collections = append(collections, c)
+	}
+
+	return collections, rows.Err()
+}
+
+// GetCollection returns collection id of userId, those of other users are not found.
+func (s *PostgresBookmarksStore) GetCollection(ctx context.Context, userId, id int64) (*BookmarkCollection, error) {
+	query := `
+	SELECT bc.id, bc.user_id, bc.name, bc.created_at,
+	(SELECT COUNT(*) FROM bookmarks b WHERE b.collection_id = bc.id)
+	FROM bookmark_collections bc
+	WHERE bc.id = $1 AND bc.user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var c BookmarkCollection
+	err := s.db.QueryRowContext(ctx, query, id, userId).Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt, &c.Count)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
+
+func (s *PostgresBookmarksStore) CreateCollection(ctx context.Context, collection *BookmarkCollection) error {
+	query := `
+	INSERT INTO bookmark_collections (user_id, name) VALUES ($1, $2)
+	RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, collection.UserID, collection.Name).Scan(&collection.ID, &collection.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "bookmark_collections_user_id_name_key"`:
+			return ErrorDuplicateCollection
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *PostgresBookmarksStore) RenameCollection(ctx context.Context, collection *BookmarkCollection) error {
+	query := `UPDATE bookmark_collections SET name = $1 WHERE id = $2 AND user_id = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, collection.Name, collection.ID, collection.UserID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "bookmark_collections_user_id_name_key"`:
+			return ErrorDuplicateCollection
+		default:
+			return err
+		}
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+// DeleteCollection deletes collection id of userId, its bookmarks are kept
+// outside of any collection.
+func (s *PostgresBookmarksStore) DeleteCollection(ctx context.Context, userId, id int64) error {
+	query := `DELETE FROM bookmark_collections WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
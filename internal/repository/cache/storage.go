@@ -0,0 +1,23 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/go-redis/redis/v8"
+)
+
+type Storage struct {
+	Timelines interface {
+		Get(context.Context, int64, repository.PaginatedFeedQuery) ([]repository.TimelineEntry, bool, error)
+		Push(ctx context.Context, userIds []int64, entry repository.TimelineEntry) error
+		Warm(context.Context, int64, []repository.TimelineEntry) error
+		Invalidate(context.Context, int64) error
+	}
+}
+
+func NewRedisStorage(rdb *redis.Client) Storage {
+	return Storage{
+		Timelines: &RedisTimelineStore{rdb},
+	}
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/repository"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// TimelineSize is how many of the newest entries are kept per cached timeline.
+	TimelineSize = 800
+	TimelineExp  = time.Hour * 24
+)
+
+// pushScript only adds to timelines that are already cached, a partial one would
+// hide the older entries that are still in Postgres.
+var pushScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	redis.call("ZADD", KEYS[1], ARGV[1], ARGV[2])
+	redis.call("ZREMRANGEBYRANK", KEYS[1], 0, -(tonumber(ARGV[3]) + 1))
+end
+return 0
+`)
+
+// pageScript returns the page of KEYS[1] that starts after the entry scored
+// ARGV[1] with member ARGV[2], or the first page when ARGV[1] is empty. Posts are
+// scored by their created_at in seconds and members are zero padded post ids, so
+// members sharing a score are ordered by id and the page starts by rank however
+// many of them there are. It runs as a script so a push can't shift the ranks
+// between counting and reading.
+var pageScript = redis.NewScript(`
+local start = 0
+if ARGV[1] ~= "" then
+	start = redis.call("ZCOUNT", KEYS[1], "(" .. ARGV[1], "+inf")
+	for _, member in ipairs(redis.call("ZRANGEBYSCORE", KEYS[1], ARGV[1], ARGV[1])) do
+		if member >= ARGV[2] then
+			start = start + 1
+		end
+	end
+end
+return redis.call("ZREVRANGE", KEYS[1], start, start + tonumber(ARGV[3]) - 1, "WITHSCORES")
+`)
+
+type RedisTimelineStore struct {
+	rdb *redis.Client
+}
+
+// Get returns a page of the cached timeline of userId, newest first. The second
+// result is false when the timeline is not cached or the page reaches past the
+// entries kept in Redis, the caller then reads it from Postgres.
+func (s *RedisTimelineStore) Get(ctx context.Context, userId int64, fq repository.PaginatedFeedQuery) ([]repository.TimelineEntry, bool, error) {
+	key := timelineKey(userId)
+
+	size, err := s.rdb.ZCard(ctx, key).Result()
+	if err != nil || size == 0 {
+		return nil, false, err
+	}
+
+	var score, member string
+	if fq.Cursor != nil {
+		score = strconv.FormatInt(fq.Cursor.At.Unix(), 10)
+		member = timelineMember(fq.Cursor.ID)
+	}
+
+	page, err := pageScript.Run(ctx, s.rdb, []string{key}, score, member, fq.Limit).StringSlice()
+	if err != nil {
+		return nil, false, err
+	}
+
+	entries := make([]repository.TimelineEntry, 0, len(page)/2)
+	for i := 0; i+1 < len(page); i += 2 {
+		id, err := strconv.ParseInt(page[i], 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("timeline %s: invalid member %q", key, page[i])
+		}
+
+		at, err := strconv.ParseFloat(page[i+1], 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("timeline %s: invalid score %q", key, page[i+1])
+		}
+
+		entries = append(entries, repository.TimelineEntry{PostID: id, CreatedAt: time.Unix(int64(at), 0)})
+	}
+
+	if len(entries) < fq.Limit && size >= TimelineSize {
+		return nil, false, nil
+	}
+
+	return entries, true, nil
+}
+
+// Push adds entry to the cached timelines of userIds, skipping those not in Redis.
+func (s *RedisTimelineStore) Push(ctx context.Context, userIds []int64, entry repository.TimelineEntry) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+
+	pipe := s.rdb.Pipeline()
+	for _, id := range userIds {
+		pushScript.Eval(ctx, pipe, []string{timelineKey(id)}, entry.CreatedAt.Unix(), timelineMember(entry.PostID), TimelineSize)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Warm replaces the cached timeline of userId with entries.
+func (s *RedisTimelineStore) Warm(ctx context.Context, userId int64, entries []repository.TimelineEntry) error {
+	key := timelineKey(userId)
+
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+
+	if len(entries) > 0 {
+		members := make([]*redis.Z, len(entries))
+		for i, e := range entries {
+			members[i] = &redis.Z{Score: float64(e.CreatedAt.Unix()), Member: timelineMember(e.PostID)}
+		}
+
+		pipe.ZAdd(ctx, key, members...)
+		pipe.Expire(ctx, key, TimelineExp)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisTimelineStore) Invalidate(ctx context.Context, userId int64) error {
+	return s.rdb.Del(ctx, timelineKey(userId)).Err()
+}
+
+// timelineKey is versioned since the members changed format, timelines cached
+// with the former one expire on their own.
+func timelineKey(userId int64) string {
+	return fmt.Sprintf("timeline:v2:%d", userId)
+}
+
+// timelineMember pads postId so the lexical order of members is their numeric order.
+func timelineMember(postId int64) string {
+	return fmt.Sprintf("%019d", postId)
+}
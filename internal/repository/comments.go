@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"time"
 )
 
 type PostgresCommentsStore struct {
@@ -10,26 +12,31 @@ type PostgresCommentsStore struct {
 }
 
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	User      User   `json:"user"`
+	ID        int64      `json:"id"`
+	PostID    int64      `json:"post_id"`
+	ParentID  *int64     `json:"parent_id"`
+	UserID    int64      `json:"user_id"`
+	Content   string     `json:"content"`
+	CreatedAt string     `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at"`
+	User      User       `json:"user"`
+	Entities  Entities   `json:"entities"`
 }
 
-func (s *PostgresCommentsStore) GetByPostId(ctx context.Context, postID int64) ([]Comment, error) {
+// GetByPostId lists the comments of a post, leaving out those of users that
+// blocked viewerId or that viewerId blocked.
+func (s *PostgresCommentsStore) GetByPostId(ctx context.Context, postID int64, viewerId int64) ([]Comment, error) {
 	query := `
-		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id  FROM comments c
+		SELECT c.id, c.post_id, c.parent_id, c.user_id, c.content, c.created_at, c.edited_at, users.username, users.id  FROM comments c
 		JOIN users on users.id = c.user_id
-		WHERE c.post_id = $1
+		WHERE c.post_id = $1 AND ` + notBlocked("c.user_id", "$2") + `
 		ORDER BY c.created_at DESC;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	rows, err := s.db.QueryContext(ctx, query, postID, viewerId)
 	if err != nil {
 		return nil, err
 	}
@@ -39,7 +46,7 @@ func (s *PostgresCommentsStore) GetByPostId(ctx context.Context, postID int64) (
 	for rows.Next() {
 		var c Comment
 		c.User = User{}
-		err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID)
+		err := rows.Scan(&c.ID, &c.PostID, &c.ParentID, &c.UserID, &c.Content, &c.CreatedAt, &c.EditedAt, &c.User.Username, &c.User.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -49,20 +56,62 @@ func (s *PostgresCommentsStore) GetByPostId(ctx context.Context, postID int64) (
 	return comments, nil
 }
 
+func (s *PostgresCommentsStore) GetById(ctx context.Context, id int64) (*Comment, error) {
+	query := `
+	SELECT c.id, c.post_id, c.parent_id, c.user_id, c.content, c.created_at, c.edited_at, users.username, users.id
+	FROM comments c
+	JOIN users on users.id = c.user_id
+	WHERE c.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var c Comment
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&c.ID, &c.PostID, &c.ParentID, &c.UserID, &c.Content, &c.CreatedAt, &c.EditedAt, &c.User.Username, &c.User.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
+
 func (s *PostgresCommentsStore) Create(ctx context.Context, comment *Comment) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.create(ctx, tx, comment); err != nil {
+			return err
+		}
+
+		mentions, err := replaceMentions(ctx, tx, "comment_id", comment.ID, comment.UserID, comment.Content)
+		if err != nil {
+			return err
+		}
+
+		comment.Entities.Mentions = mentions
+		return nil
+	})
+}
+
+func (s *PostgresCommentsStore) create(ctx context.Context, tx *sql.Tx, comment *Comment) error {
 	query := `
-	INSERT INTO comments (post_id,user_id,content)
-	VALUES ($1,$2,$3)
+	INSERT INTO comments (post_id,parent_id,user_id,content)
+	VALUES ($1,$2,$3,$4)
 	RETURNING id, created_at	
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
+	err := tx.QueryRowContext(
 		ctx,
 		query,
 		comment.PostID,
+		comment.ParentID,
 		comment.UserID,
 		comment.Content,
 	).Scan(
@@ -76,3 +125,55 @@ func (s *PostgresCommentsStore) Create(ctx context.Context, comment *Comment) er
 
 	return nil
 }
+
+// Update replaces the content of comment, and the mentions in it, marking it as edited.
+func (s *PostgresCommentsStore) Update(ctx context.Context, comment *Comment) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE comments SET content = $1, edited_at = NOW() WHERE id = $2 RETURNING edited_at`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, comment.Content, comment.ID).Scan(&comment.EditedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+
+		mentions, err := replaceMentions(ctx, tx, "comment_id", comment.ID, comment.UserID, comment.Content)
+		if err != nil {
+			return err
+		}
+
+		comment.Entities.Mentions = mentions
+		return nil
+	})
+}
+
+// Delete removes a comment along with the replies to it.
+func (s *PostgresCommentsStore) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM comments WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
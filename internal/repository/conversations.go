@@ -0,0 +1,390 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Conversation struct {
+	ID        int64 `json:"id"`
+	IsGroup   bool  `json:"is_group"`
+	CreatedBy int64 `json:"created_by"`
+	// Members carry the read receipts: the last message each of them read.
+	Members     []ConversationMember `json:"members"`
+	LastMessage *Message             `json:"last_message"`
+	UnreadCount int                  `json:"unread_count"`
+	CreatedAt   string               `json:"created_at"`
+	UpdatedAt   string               `json:"updated_at"`
+}
+
+type ConversationMember struct {
+	UserID            int64      `json:"user_id"`
+	Username          string     `json:"username"`
+	LastReadMessageID *int64     `json:"last_read_message_id"`
+	LastReadAt        *time.Time `json:"last_read_at"`
+}
+
+type Message struct {
+	ID             int64  `json:"id"`
+	ConversationID int64  `json:"conversation_id"`
+	UserID         int64  `json:"user_id"`
+	Content        string `json:"content"`
+	CreatedAt      string `json:"created_at"`
+	User           User   `json:"user"`
+}
+
+type PostgresConversationsStore struct {
+	db *sql.DB
+}
+
+// Create starts a conversation between creatorId and memberIds. A conversation
+// with a single other member is one-to-one and two users only ever have one,
+// for those the existing conversation is returned and the second result is false.
+func (s *PostgresConversationsStore) Create(ctx context.Context, creatorId int64, memberIds []int64) (int64, bool, error) {
+	var id int64
+	var created bool
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		var directKey *string
+		if len(memberIds) == 1 {
+			key := fmt.Sprintf("%d:%d", min(creatorId, memberIds[0]), max(creatorId, memberIds[0]))
+			directKey = &key
+		}
+
+		query := `
+		INSERT INTO conversations (created_by, direct_key) VALUES ($1, $2)
+		ON CONFLICT (direct_key) DO NOTHING
+		RETURNING id
+		`
+
+		err := tx.QueryRowContext(ctx, query, creatorId, directKey).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return tx.QueryRowContext(ctx, `SELECT id FROM conversations WHERE direct_key = $1`, directKey).Scan(&id)
+		}
+		if err != nil {
+			return err
+		}
+
+		query = `
+		INSERT INTO conversation_members (conversation_id, user_id)
+		SELECT $1, unnest($2::bigint[])
+		`
+
+		if _, err := tx.ExecContext(ctx, query, id, pq.Array(append([]int64{creatorId}, memberIds...))); err != nil {
+			return err
+		}
+
+		created = true
+		return nil
+	})
+
+	return id, created, err
+}
+
+// GetUnreachable returns which of recipientIds senderId can't start a
+// conversation with: accounts that don't exist or aren't active, that are
+// blocked either way with the sender, or that only take messages from the
+// accounts they follow and don't follow the sender.
+func (s *PostgresConversationsStore) GetUnreachable(ctx context.Context, senderId int64, recipientIds []int64) ([]int64, error) {
+	query := `
+	SELECT t.id
+	FROM unnest($2::bigint[]) AS t(id)
+	LEFT JOIN users u ON u.id = t.id AND u.is_active = true
+	WHERE u.id IS NULL OR NOT ` + notBlocked("t.id", "$1") + `
+	OR (u.dm_followers_only AND NOT EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $1 AND f.follower_id = t.id))
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, senderId, pq.Array(recipientIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// conversationsQuery selects the conversations of the member in $1 along with
+// their latest message and how many messages of the others they haven't read.
+// Messages of users blocked either way with the member are left out, and so are
+// the one-to-one conversations with them.
+var conversationsQuery = `
+	SELECT c.id, c.direct_key IS NULL, c.created_by, c.created_at, c.updated_at,
+	lm.id, lm.user_id, lm.content, lm.created_at, lu.username,
+	(
+		SELECT COUNT(*) FROM messages um
+		WHERE um.conversation_id = c.id AND um.id > COALESCE(cm.last_read_message_id, 0)
+		AND um.user_id <> $1 AND ` + notBlocked("um.user_id", "$1") + `
+	)
+	FROM conversation_members cm
+	JOIN conversations c ON c.id = cm.conversation_id
+	LEFT JOIN LATERAL (
+		SELECT m.id, m.user_id, m.content, m.created_at
+		FROM messages m
+		WHERE m.conversation_id = c.id AND ` + notBlocked("m.user_id", "$1") + `
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT 1
+	) lm ON true
+	LEFT JOIN users lu ON lu.id = lm.user_id
+	WHERE cm.user_id = $1 AND (c.direct_key IS NULL OR NOT EXISTS (
+		SELECT 1 FROM conversation_members o
+		WHERE o.conversation_id = c.id AND o.user_id <> $1 AND NOT ` + notBlocked("o.user_id", "$1") + `
+	))
+	`
+
+// GetById returns conversation id as seen by its member userId.
+func (s *PostgresConversationsStore) GetById(ctx context.Context, id int64, userId int64) (*Conversation, error) {
+	query := conversationsQuery + ` AND c.id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations, err := s.scan(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conversations) == 0 {
+		return nil, ErrorNotFound
+	}
+
+	return &conversations[0], nil
+}
+
+// GetByUser lists the conversations of userId, the most recently active first.
+func (s *PostgresConversationsStore) GetByUser(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]Conversation, error) {
+	keyset, args := fq.keyset("c.updated_at", "c.id", 4)
+
+	query := conversationsQuery + ` AND ` + keyset + `
+	ORDER BY c.updated_at ` + fq.Sort + `, c.id ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{userId, fq.Limit, fq.Offset}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scan(ctx, rows)
+}
+
+// scan reads the rows of conversationsQuery and loads the members of each conversation.
+func (s *PostgresConversationsStore) scan(ctx context.Context, rows *sql.Rows) ([]Conversation, error) {
+	conversations := []Conversation{}
+	for rows.Next() {
+		var c Conversation
+		var lastId, lastUserId *int64
+		var lastContent, lastCreatedAt, lastUsername *string
+
+		err := rows.Scan(
+			&c.ID,
+			&c.IsGroup,
+			&c.CreatedBy,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+			&lastId,
+			&lastUserId,
+			&lastContent,
+			&lastCreatedAt,
+			&lastUsername,
+			&c.UnreadCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if lastId != nil {
+			c.LastMessage = &Message{
+				ID:             *lastId,
+				ConversationID: c.ID,
+				UserID:         *lastUserId,
+				Content:        *lastContent,
+				CreatedAt:      *lastCreatedAt,
+				User:           User{ID: *lastUserId, Username: *lastUsername},
+			}
+		}
+
+		conversations = append(conversations, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(conversations) == 0 {
+		return conversations, nil
+	}
+
+	ids := make([]int64, len(conversations))
+	for i, c := range conversations {
+		ids[i] = c.ID
+	}
+
+	members, err := s.getMembers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range conversations {
+		conversations[i].Members = members[conversations[i].ID]
+	}
+
+	return conversations, nil
+}
+
+func (s *PostgresConversationsStore) getMembers(ctx context.Context, conversationIds []int64) (map[int64][]ConversationMember, error) {
+	query := `
+	SELECT cm.conversation_id, u.id, u.username, cm.last_read_message_id, cm.last_read_at
+	FROM conversation_members cm
+	JOIN users u ON u.id = cm.user_id
+	WHERE cm.conversation_id = ANY($1)
+	ORDER BY cm.joined_at, u.id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(conversationIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make(map[int64][]ConversationMember, len(conversationIds))
+	for rows.Next() {
+		var conversationId int64
+		var m ConversationMember
+		if err := rows.Scan(&conversationId, &m.UserID, &m.Username, &m.LastReadMessageID, &m.LastReadAt); err != nil {
+			return nil, err
+		}
+
+		members[conversationId] = append(members[conversationId], m)
+	}
+
+	return members, rows.Err()
+}
+
+// GetMessages lists the messages of conversationId, newest first by default,
+// leaving out those of users blocked either way with viewerId.
+func (s *PostgresConversationsStore) GetMessages(ctx context.Context, conversationId int64, viewerId int64, fq PaginatedFeedQuery) ([]Message, error) {
+	keyset, args := fq.keyset("m.created_at", "m.id", 5)
+
+	query := `
+	SELECT m.id, m.conversation_id, m.user_id, m.content, m.created_at, u.username
+	FROM messages m
+	JOIN users u ON u.id = m.user_id
+	WHERE m.conversation_id = $1 AND ` + notBlocked("m.user_id", "$4") + ` AND ` + keyset + `
+	ORDER BY m.created_at ` + fq.Sort + `, m.id ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{conversationId, fq.Limit, fq.Offset, viewerId}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.UserID, &m.Content, &m.CreatedAt, &m.User.Username); err != nil {
+			return nil, err
+		}
+
+		m.User.ID = m.UserID
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// CreateMessage adds message to its conversation, which it moves to the top of
+// the conversation lists. The sender has read everything up to their own message.
+func (s *PostgresConversationsStore) CreateMessage(ctx context.Context, message *Message) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		query := `
+		INSERT INTO messages (conversation_id, user_id, content) VALUES ($1, $2, $3)
+		RETURNING id, created_at
+		`
+
+		err := tx.QueryRowContext(ctx, query, message.ConversationID, message.UserID, message.Content).Scan(
+			&message.ID,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE conversations SET updated_at = NOW() WHERE id = $1`, message.ConversationID); err != nil {
+			return err
+		}
+
+		query = `
+		UPDATE conversation_members SET last_read_message_id = $3, last_read_at = NOW()
+		WHERE conversation_id = $1 AND user_id = $2
+		`
+
+		_, err = tx.ExecContext(ctx, query, message.ConversationID, message.UserID, message.ID)
+		return err
+	})
+}
+
+// MarkRead moves the read receipt of userId in conversationId up to message
+// upTo, or to the latest message when upTo is 0. It returns the message the
+// receipt now points at, or 0 when it didn't move.
+func (s *PostgresConversationsStore) MarkRead(ctx context.Context, conversationId int64, userId int64, upTo int64) (int64, error) {
+	query := `
+	UPDATE conversation_members cm SET last_read_message_id = l.id, last_read_at = NOW()
+	FROM (
+		SELECT MAX(id) AS id FROM messages
+		WHERE conversation_id = $1 AND ($3::bigint = 0 OR id <= $3::bigint)
+	) l
+	WHERE cm.conversation_id = $1 AND cm.user_id = $2
+	AND l.id IS NOT NULL AND l.id > COALESCE(cm.last_read_message_id, 0)
+	RETURNING cm.last_read_message_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var lastRead int64
+	err := s.db.QueryRowContext(ctx, query, conversationId, userId, upTo).Scan(&lastRead)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+
+	return lastRead, err
+}
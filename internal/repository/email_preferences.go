@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// How the notifications of a kind are mailed.
+const (
+	EmailImmediate = "immediate"
+	EmailDaily     = "daily"
+	EmailWeekly    = "weekly"
+	EmailOff       = "off"
+
+	// DefaultEmailMode applies to the kinds a user hasn't set a mode for, nobody
+	// gets emails they didn't ask for.
+	DefaultEmailMode = EmailOff
+)
+
+// NotificationKinds lists every kind of notification, in the order preferences are shown.
+var NotificationKinds = []string{
+	NotificationFollow,
+	NotificationComment,
+	NotificationReply,
+	NotificationMention,
+	NotificationReaction,
+}
+
+type PostgresEmailPreferencesStore struct {
+	db *sql.DB
+}
+
+// Get returns the mode of every notification kind for userId.
+func (s *PostgresEmailPreferencesStore) Get(ctx context.Context, userId int64) (map[string]string, error) {
+	query := `SELECT kind, mode FROM email_preferences WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := make(map[string]string, len(NotificationKinds))
+	for _, kind := range NotificationKinds {
+		prefs[kind] = DefaultEmailMode
+	}
+
+	for rows.Next() {
+		var kind, mode string
+		if err := rows.Scan(&kind, &mode); err != nil {
+			return nil, err
+		}
+
+		prefs[kind] = mode
+	}
+
+	return prefs, rows.Err()
+}
+
+// Set changes the mode of the kinds in prefs, leaving the others as they were.
+func (s *PostgresEmailPreferencesStore) Set(ctx context.Context, userId int64, prefs map[string]string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		INSERT INTO email_preferences (user_id, kind, mode) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, kind) DO UPDATE SET mode = EXCLUDED.mode
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		for kind, mode := range prefs {
+			if _, err := tx.ExecContext(ctx, query, userId, kind, mode); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DigestRecipient is a user claimed to be sent a digest, LastSentAt is when
+// the previous one went out.
+type DigestRecipient struct {
+	UserID     int64
+	LastSentAt *time.Time
+}
+
+// ClaimDigestRecipients picks up to limit active users with unread notifications
+// waiting for their digest of frequency, daily or weekly, whose last one was sent
+// at least interval ago, and records their digest as sent now. The ones who have
+// waited the longest come first so a full batch doesn't keep starving the same
+// users. Instances claiming at the same time never get the same user, the
+// second one finds the digest already sent.
+func (s *PostgresEmailPreferencesStore) ClaimDigestRecipients(ctx context.Context, frequency string, interval time.Duration, limit int) ([]DigestRecipient, error) {
+	query := `
+	WITH due AS (
+		SELECT n.user_id, d.sent_at
+		FROM notifications n
+		JOIN users u ON u.id = n.user_id AND u.is_active = true
+		LEFT JOIN email_preferences ep ON ep.user_id = n.user_id AND ep.kind = n.kind
+		LEFT JOIN email_digests d ON d.user_id = n.user_id AND d.frequency = $1
+		WHERE n.read_at IS NULL AND (n.emailed_at IS NULL OR n.emailed_at < n.updated_at)
+		AND COALESCE(ep.mode, $2) = $1
+		AND (d.sent_at IS NULL OR d.sent_at <= $3)
+		GROUP BY n.user_id, d.sent_at
+		ORDER BY d.sent_at NULLS FIRST, n.user_id
+		LIMIT $4
+	), claimed AS (
+		INSERT INTO email_digests (user_id, frequency, sent_at)
+		SELECT user_id, $1, NOW() FROM due
+		ON CONFLICT (user_id, frequency) DO UPDATE SET sent_at = EXCLUDED.sent_at
+		WHERE email_digests.sent_at <= $3
+		RETURNING user_id
+	)
+	SELECT c.user_id, due.sent_at
+	FROM claimed c
+	JOIN due ON due.user_id = c.user_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, frequency, DefaultEmailMode, time.Now().Add(-interval), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []DigestRecipient
+	for rows.Next() {
+		var r DigestRecipient
+		if err := rows.Scan(&r.UserID, &r.LastSentAt); err != nil {
+			return nil, err
+		}
+
+		recipients = append(recipients, r)
+	}
+
+	return recipients, rows.Err()
+}
+
+// ReleaseDigest gives back the claim on the digest of frequency of r when it
+// couldn't be sent, so it is due again.
+func (s *PostgresEmailPreferencesStore) ReleaseDigest(ctx context.Context, r DigestRecipient, frequency string) error {
+	query := `DELETE FROM email_digests WHERE user_id = $1 AND frequency = $2`
+	args := []any{r.UserID, frequency}
+
+	if r.LastSentAt != nil {
+		query = `UPDATE email_digests SET sent_at = $3 WHERE user_id = $1 AND frequency = $2`
+		args = append(args, *r.LastSentAt)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// FollowRequest is a pending follow of a private account, User is the other
+// side of the request from the one listing it.
+type FollowRequest struct {
+	User      FollowRequestUser `json:"user"`
+	CreatedAt string            `json:"created_at"`
+}
+
+type FollowRequestUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type PostgresFollowRequestsStore struct {
+	db *sql.DB
+}
+
+// Create asks userId to let requesterId follow them. Asking again, or asking an
+// account that is already followed, is a no-op.
+func (s *PostgresFollowRequestsStore) Create(ctx context.Context, requesterId int64, userId int64) error {
+	query := `
+	INSERT INTO follow_requests (user_id, requester_id)
+	SELECT $1, $2
+	WHERE NOT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)
+	ON CONFLICT (user_id, requester_id) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userId, requesterId)
+	return err
+}
+
+// Delete drops the request of requesterId to follow userId, it serves both the
+// rejection by userId and the cancellation by requesterId.
+func (s *PostgresFollowRequestsStore) Delete(ctx context.Context, requesterId int64, userId int64) (bool, error) {
+	query := `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	response, err := s.db.ExecContext(ctx, query, userId, requesterId)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := response.RowsAffected()
+	return rows > 0, err
+}
+
+// Approve turns the request of requesterId into a follow of userId.
+func (s *PostgresFollowRequestsStore) Approve(ctx context.Context, requesterId int64, userId int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		var id int64
+		err := tx.QueryRowContext(ctx, `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2 RETURNING requester_id`, userId, requesterId).Scan(&id)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2) ON CONFLICT (user_id, follower_id) DO NOTHING`, userId, requesterId)
+		return err
+	})
+}
+
+// GetIncoming lists the accounts waiting for userId to approve them.
+func (s *PostgresFollowRequestsStore) GetIncoming(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]FollowRequest, error) {
+	return s.list(ctx, "requester_id", "user_id", userId, fq)
+}
+
+// GetOutgoing lists the private accounts requesterId is waiting on.
+func (s *PostgresFollowRequestsStore) GetOutgoing(ctx context.Context, requesterId int64, fq PaginatedFeedQuery) ([]FollowRequest, error) {
+	return s.list(ctx, "user_id", "requester_id", requesterId, fq)
+}
+
+// list reads the accounts in column of the requests whose by column is userId.
+func (s *PostgresFollowRequestsStore) list(ctx context.Context, column, by string, userId int64, fq PaginatedFeedQuery) ([]FollowRequest, error) {
+	keyset, args := fq.keyset("r.created_at", "r."+column, 4)
+
+	query := `
+	SELECT u.id, u.username, r.created_at
+	FROM follow_requests r
+	JOIN users u ON u.id = r.` + column + `
+	WHERE r.` + by + ` = $1 AND u.is_active = true AND ` + keyset + `
+	ORDER BY r.created_at ` + fq.Sort + `, r.` + column + ` ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{userId, fq.Limit, fq.Offset}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []FollowRequest{}
+	for rows.Next() {
+		var request FollowRequest
+		if err := rows.Scan(&request.User.ID, &request.User.Username, &request.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, request)
+	}
+
+	return requests, rows.Err()
+}
@@ -3,7 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
-	"fmt"
+	"errors"
 
 	"github.com/lib/pq"
 )
@@ -18,29 +18,273 @@ type FollowerRepository struct {
 	db *sql.DB
 }
 
-func (s *FollowerRepository) Follow(ctx context.Context, followerId int64, userId int64) error {
-	query := `INSERT INTO followers (user_id,follower_id) VALUES ($1,$2)`
+// Relationship is how the viewer and another user follow each other.
+type Relationship struct {
+	UserID     int64 `json:"user_id"`
+	Following  bool  `json:"following"`
+	FollowedBy bool  `json:"followed_by"`
+	// Requested is set while the viewer waits for a private account to approve them.
+	Requested bool `json:"requested"`
+}
+
+// Follow makes followerId follow userId, following an account twice is a no-op.
+// It reports whether a new follow was created.
+func (s *FollowerRepository) Follow(ctx context.Context, followerId int64, userId int64) (bool, error) {
+	query := `INSERT INTO followers (user_id,follower_id) VALUES ($1,$2) ON CONFLICT (user_id, follower_id) DO NOTHING`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userId, followerId)
-	return err
+	response, err := s.db.ExecContext(ctx, query, userId, followerId)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return false, ErrorNotFound
+		}
+		return false, err
+	}
 
+	rows, err := response.RowsAffected()
+	return rows > 0, err
 }
 
-func (s *FollowerRepository) Unfollow(ctx context.Context, followerId int64, userId int64) error {
+// Unfollow removes the follow of followerId on userId, if there is one, and
+// reports whether there was.
+func (s *FollowerRepository) Unfollow(ctx context.Context, followerId int64, userId int64) (bool, error) {
 	query := `DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userId, followerId)
+	response, err := s.db.ExecContext(ctx, query, userId, followerId)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := response.RowsAffected()
+	return rows > 0, err
+}
+
+func (s *FollowerRepository) GetRelationship(ctx context.Context, viewerId int64, userId int64) (*Relationship, error) {
+	query := `
+	SELECT
+	EXISTS (SELECT 1 FROM followers WHERE user_id = $2 AND follower_id = $1),
+	EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2),
+	EXISTS (SELECT 1 FROM follow_requests WHERE user_id = $2 AND requester_id = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	relationship := &Relationship{UserID: userId}
+	err := s.db.QueryRowContext(ctx, query, viewerId, userId).Scan(&relationship.Following, &relationship.FollowedBy, &relationship.Requested)
+	if err != nil {
+		return nil, err
+	}
+
+	return relationship, nil
+}
+
+// GetFollowerIds lists the ids of every active account following userId.
+func (s *FollowerRepository) GetFollowerIds(ctx context.Context, userId int64) ([]int64, error) {
+	query := `
+	SELECT f.follower_id
+	FROM followers f
+	JOIN users u ON u.id = f.follower_id
+	WHERE f.user_id = $1 AND u.is_active = true
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// CountFollowers reads the follower count kept up to date by the followers_counts trigger.
+func (s *FollowerRepository) CountFollowers(ctx context.Context, userId int64) (int64, error) {
+	query := `SELECT followers_count FROM users WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var count int64
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&count)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrorNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return count, nil
+}
+
+// GetFollowedAbove lists the accounts followerId follows that have more than
+// threshold followers.
+func (s *FollowerRepository) GetFollowedAbove(ctx context.Context, followerId int64, threshold int64) ([]int64, error) {
+	query := `
+	SELECT u.id
+	FROM followers f
+	JOIN users u ON u.id = f.user_id
+	WHERE f.follower_id = $1 AND u.followers_count > $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, followerId, threshold)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// FollowListEntry is an account in a followers or following list, with how it
+// relates to the viewer of the list.
+type FollowListEntry struct {
+	ID               int64  `json:"id"`
+	Username         string `json:"username"`
+	FollowedAt       string `json:"followed_at"`
+	FollowedByViewer bool   `json:"followed_by_viewer"`
+	FollowsViewer    bool   `json:"follows_viewer"`
+}
+
+// GetFollowers lists the active accounts following userId, most recent follows first.
+func (s *FollowerRepository) GetFollowers(ctx context.Context, userId int64, viewerId int64, fq PaginatedFeedQuery) ([]FollowListEntry, error) {
+	return s.list(ctx, "follower_id", "user_id", userId, viewerId, fq)
+}
+
+// GetFollowing lists the active accounts userId follows, most recent follows first.
+func (s *FollowerRepository) GetFollowing(ctx context.Context, userId int64, viewerId int64, fq PaginatedFeedQuery) ([]FollowListEntry, error) {
+	return s.list(ctx, "user_id", "follower_id", userId, viewerId, fq)
+}
+
+// list reads the accounts in column of the followers rows whose by column is userId.
+func (s *FollowerRepository) list(ctx context.Context, column, by string, userId int64, viewerId int64, fq PaginatedFeedQuery) ([]FollowListEntry, error) {
+	keyset, args := fq.keyset("f.created_at", "f."+column, 5)
+
+	query := `
+	SELECT u.id, u.username, f.created_at,
+	EXISTS (SELECT 1 FROM followers v WHERE v.user_id = u.id AND v.follower_id = $4),
+	EXISTS (SELECT 1 FROM followers v WHERE v.user_id = $4 AND v.follower_id = u.id)
+	FROM followers f
+	JOIN users u ON u.id = f.` + column + `
+	WHERE f.` + by + ` = $1 AND u.is_active = true AND ` + notBlocked("u.id", "$4") + ` AND ` + keyset + `
+	ORDER BY f.created_at ` + fq.Sort + `, f.` + column + ` ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{userId, fq.Limit, fq.Offset, viewerId}, args...)...)
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			return fmt.Errorf("duplicate key value violates unique constraint")
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []FollowListEntry{}
+	for rows.Next() {
+		var e FollowListEntry
+		if err := rows.Scan(&e.ID, &e.Username, &e.FollowedAt, &e.FollowedByViewer, &e.FollowsViewer); err != nil {
+			return nil, err
 		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// Suggestion is an account followed by people the viewer follows.
+type Suggestion struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// MutualCount is how many of the accounts the viewer follows follow this one,
+	// FollowedBy names the two with the most followers among them.
+	MutualCount int      `json:"mutual_count"`
+	FollowedBy  []string `json:"followed_by"`
+	// RecentPosts counts the posts published over the last 30 days.
+	RecentPosts int    `json:"recent_posts"`
+	Reason      string `json:"reason"`
+}
+
+// GetSuggestions lists the active accounts followed by the accounts userId
+// follows, those followed by the most of them first and then the most active.
+// Accounts userId already follows, asked to follow or is blocked with either
+// way are left out.
+func (s *FollowerRepository) GetSuggestions(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]Suggestion, error) {
+	query := `
+	WITH candidates AS (
+		SELECT f.user_id AS id, COUNT(*) AS mutuals,
+		(ARRAY_AGG(m.username ORDER BY m.followers_count DESC, m.id))[1:2] AS followed_by
+		FROM followers f
+		JOIN followers mine ON mine.user_id = f.follower_id AND mine.follower_id = $1
+		JOIN users m ON m.id = f.follower_id AND m.is_active = true
+		WHERE f.user_id <> $1
+		AND NOT EXISTS (SELECT 1 FROM followers v WHERE v.user_id = f.user_id AND v.follower_id = $1)
+		GROUP BY f.user_id
+	)
+	SELECT u.id, u.username, c.mutuals, c.followed_by,
+	(SELECT COUNT(*) FROM posts p
+		WHERE p.user_id = u.id AND p.status = 'published' AND p.deleted_at IS NULL
+		AND p.created_at > NOW() - INTERVAL '30 days') AS recent_posts
+	FROM candidates c
+	JOIN users u ON u.id = c.id
+	WHERE u.is_active = true AND ` + notBlocked("u.id", "$1") + `
+	AND NOT EXISTS (SELECT 1 FROM follow_requests r WHERE r.user_id = u.id AND r.requester_id = $1)
+	ORDER BY c.mutuals DESC, recent_posts DESC, u.id
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var sg Suggestion
+		if err := rows.Scan(&sg.ID, &sg.Username, &sg.MutualCount, pq.Array(&sg.FollowedBy), &sg.RecentPosts); err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, sg)
 	}
 
-	return err
+	return suggestions, rows.Err()
 }
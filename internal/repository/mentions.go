@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/carlosEA28/Social/internal/entities"
+	"github.com/lib/pq"
+)
+
+// Mention is a resolved @username, Start and End are code point offsets into the content.
+type Mention struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// Hashtag is a #tag in the content, Tag holds its normalized form.
+type Hashtag struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// Entities are the structured parts of a post or comment body that clients can link.
+type Entities struct {
+	Mentions []Mention `json:"mentions"`
+	Hashtags []Hashtag `json:"hashtags"`
+}
+
+type PostgresMentionsStore struct {
+	db *sql.DB
+}
+
+func (s *PostgresMentionsStore) GetByPostIds(ctx context.Context, postIds []int64) (map[int64][]Mention, error) {
+	return s.getBy(ctx, "post_id", postIds)
+}
+
+func (s *PostgresMentionsStore) GetByCommentIds(ctx context.Context, commentIds []int64) (map[int64][]Mention, error) {
+	return s.getBy(ctx, "comment_id", commentIds)
+}
+
+func (s *PostgresMentionsStore) getBy(ctx context.Context, column string, ids []int64) (map[int64][]Mention, error) {
+	query := `
+	SELECT m.` + column + `, m.user_id, u.username, m.start_offset, m.end_offset
+	FROM mentions m
+	JOIN users u ON u.id = m.user_id
+	WHERE m.` + column + ` = ANY($1)
+	ORDER BY m.start_offset
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := make(map[int64][]Mention)
+	for rows.Next() {
+		var id int64
+		var m Mention
+		if err := rows.Scan(&id, &m.UserID, &m.Username, &m.Start, &m.End); err != nil {
+			return nil, err
+		}
+
+		mentions[id] = append(mentions[id], m)
+	}
+
+	return mentions, rows.Err()
+}
+
+// replaceMentions parses the @usernames in content, resolves the ones that match an
+// active user and stores them for the post or comment, dropping what was there before.
+// column is either post_id or comment_id.
+func replaceMentions(ctx context.Context, tx *sql.Tx, column string, id int64, authorId int64, content string) ([]Mention, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mentions WHERE `+column+` = $1`, id); err != nil {
+		return nil, err
+	}
+
+	parsed := entities.ParseMentions(content)
+	if len(parsed) == 0 {
+		return []Mention{}, nil
+	}
+
+	usernames := make([]string, len(parsed))
+	for i, m := range parsed {
+		usernames[i] = m.Username
+	}
+
+	// users that blocked the author, or that the author blocked, can't be mentioned by them
+	query := `SELECT id, username FROM users WHERE username = ANY($1) AND is_active = true AND ` + notBlocked("users.id", "$2")
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(usernames), authorId)
+	if err != nil {
+		return nil, err
+	}
+
+	userIds := make(map[string]int64)
+	for rows.Next() {
+		var userId int64
+		var username string
+		if err := rows.Scan(&userId, &username); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		userIds[username] = userId
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+	INSERT INTO mentions (` + column + `, user_id, author_id, start_offset, end_offset)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+
+	mentions := []Mention{}
+	for _, m := range parsed {
+		userId, ok := userIds[m.Username]
+		if !ok {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, query, id, userId, authorId, m.Start, m.End); err != nil {
+			return nil, err
+		}
+
+		mentions = append(mentions, Mention{
+			UserID:   userId,
+			Username: m.Username,
+			Start:    m.Start,
+			End:      m.End,
+		})
+	}
+
+	return mentions, nil
+}
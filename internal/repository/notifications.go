@@ -0,0 +1,371 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	NotificationFollow   = "follow"
+	NotificationComment  = "comment"
+	NotificationReply    = "reply"
+	NotificationMention  = "mention"
+	NotificationReaction = "reaction"
+)
+
+// NewNotification is an event to let UserID know about. Events with the same
+// GroupKey are coalesced into the same notification until it is read.
+type NewNotification struct {
+	UserID    int64
+	ActorID   int64
+	Kind      string
+	GroupKey  string
+	PostID    *int64
+	CommentID *int64
+}
+
+type NotificationActor struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type Notification struct {
+	ID   int64  `json:"id"`
+	Kind string `json:"kind"`
+	// PostID and CommentID point at what the notification is about, for coalesced
+	// notifications CommentID is the most recent comment.
+	PostID     *int64 `json:"post_id"`
+	CommentID  *int64 `json:"comment_id"`
+	ActorCount int    `json:"actor_count"`
+	// Actors lists the three most recent actors, the others are only counted.
+	Actors    []NotificationActor `json:"actors"`
+	Summary   string              `json:"summary"`
+	Read      bool                `json:"read"`
+	CreatedAt string              `json:"created_at"`
+	UpdatedAt string              `json:"updated_at"`
+}
+
+// notificationActors counts the actors of the notification n of the user in $1
+// and lists the three most recent, leaving out those blocked either way with
+// the user or no longer active.
+var notificationActors = `
+	SELECT COUNT(*) AS actor_count,
+	(ARRAY_AGG(u.id ORDER BY na.created_at DESC, u.id))[1:3] AS actor_ids,
+	(ARRAY_AGG(u.username ORDER BY na.created_at DESC, u.id))[1:3] AS actor_names
+	FROM notification_actors na
+	JOIN users u ON u.id = na.actor_id
+	WHERE na.notification_id = n.id AND u.is_active = true AND ` + notBlocked("u.id", "$1")
+
+type PostgresNotificationsStore struct {
+	db *sql.DB
+}
+
+// Record adds n to the unread notification of the same group, creating it when
+// there is none. Nothing is recorded when the actor and the recipient are blocked
+// either way, it returns the id of the notification n was recorded in or 0 when
+// it wasn't.
+func (s *PostgresNotificationsStore) Record(ctx context.Context, n NewNotification) (int64, error) {
+	var recorded int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		query := `
+		INSERT INTO notifications (user_id, kind, group_key, post_id, comment_id)
+		SELECT $1::bigint, $2::varchar, $3::varchar, $4::bigint, $5::bigint
+		WHERE ` + notBlocked("$1::bigint", "$6::bigint") + `
+		ON CONFLICT (user_id, group_key) WHERE read_at IS NULL
+		DO UPDATE SET comment_id = COALESCE(EXCLUDED.comment_id, notifications.comment_id), updated_at = NOW()
+		RETURNING id
+		`
+
+		var id int64
+		err := tx.QueryRowContext(ctx, query, n.UserID, n.Kind, n.GroupKey, n.PostID, n.CommentID, n.ActorID).Scan(&id)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return nil
+			default:
+				return err
+			}
+		}
+
+		query = `
+		INSERT INTO notification_actors (notification_id, actor_id) VALUES ($1, $2)
+		ON CONFLICT (notification_id, actor_id) DO UPDATE SET created_at = NOW()
+		`
+
+		if _, err := tx.ExecContext(ctx, query, id, n.ActorID); err != nil {
+			return err
+		}
+
+		recorded = id
+		return nil
+	})
+
+	return recorded, err
+}
+
+// Get lists the notifications of userId, most recently updated first. Actors
+// that are blocked either way with userId or no longer active are left out, along
+// with notifications that have no actors left.
+func (s *PostgresNotificationsStore) Get(ctx context.Context, userId int64, unreadOnly bool, fq PaginatedFeedQuery) ([]Notification, error) {
+	keyset, args := fq.keyset("n.updated_at", "n.id", 5)
+
+	query := `
+	SELECT n.id, n.kind, n.post_id, n.comment_id, a.actor_count, a.actor_ids, a.actor_names,
+	n.read_at IS NOT NULL, n.created_at, n.updated_at
+	FROM notifications n
+	CROSS JOIN LATERAL (` + notificationActors + `) a
+	WHERE n.user_id = $1 AND a.actor_count > 0 AND (NOT $4 OR n.read_at IS NULL) AND ` + keyset + `
+	ORDER BY n.updated_at ` + fq.Sort + `, n.id ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{userId, fq.Limit, fq.Offset, unreadOnly}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNotifications(rows)
+}
+
+// GetForDigest lists the unread notifications of userId whose kind is mailed in
+// the digest of mode and that changed since they were last mailed, most recently
+// updated first.
+func (s *PostgresNotificationsStore) GetForDigest(ctx context.Context, userId int64, mode string, limit int) ([]Notification, error) {
+	query := `
+	SELECT n.id, n.kind, n.post_id, n.comment_id, a.actor_count, a.actor_ids, a.actor_names,
+	n.read_at IS NOT NULL, n.created_at, n.updated_at
+	FROM notifications n
+	LEFT JOIN email_preferences ep ON ep.user_id = n.user_id AND ep.kind = n.kind
+	CROSS JOIN LATERAL (` + notificationActors + `) a
+	WHERE n.user_id = $1 AND a.actor_count > 0 AND n.read_at IS NULL
+	AND (n.emailed_at IS NULL OR n.emailed_at < n.updated_at) AND COALESCE(ep.mode, $3) = $4
+	ORDER BY n.updated_at DESC, n.id DESC
+	LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId, limit, DefaultEmailMode, mode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNotifications(rows)
+}
+
+// MarkEmailed records that the unread notifications of userId with the given
+// ids were just mailed.
+func (s *PostgresNotificationsStore) MarkEmailed(ctx context.Context, userId int64, ids []int64) error {
+	query := `UPDATE notifications SET emailed_at = NOW() WHERE user_id = $1 AND id = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userId, pq.Array(ids))
+	return err
+}
+
+// NotificationEmail is a notification claimed to be mailed to UserID.
+type NotificationEmail struct {
+	ID     int64
+	UserID int64
+}
+
+// ClaimEmails marks as mailed up to limit unread notifications of the kinds their
+// recipients want mailed as they happen, that have activity they weren't mailed
+// about and weren't mailed less than throttle ago. A burst of reactions to the
+// same post sends one email instead of one each. They are claimed before being
+// sent so that two instances never mail the same one, a send that fails isn't
+// retried.
+func (s *PostgresNotificationsStore) ClaimEmails(ctx context.Context, limit int, throttle time.Duration) ([]NotificationEmail, error) {
+	query := `
+	UPDATE notifications SET emailed_at = NOW()
+	WHERE id IN (
+		SELECT n.id
+		FROM notifications n
+		JOIN users u ON u.id = n.user_id AND u.is_active = true
+		LEFT JOIN email_preferences ep ON ep.user_id = n.user_id AND ep.kind = n.kind
+		WHERE n.read_at IS NULL AND COALESCE(ep.mode, $2) = $3
+		AND (n.emailed_at IS NULL OR (n.emailed_at < n.updated_at AND n.emailed_at <= $4))
+		ORDER BY n.updated_at, n.id
+		LIMIT $1
+		FOR UPDATE OF n SKIP LOCKED
+	)
+	RETURNING id, user_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, DefaultEmailMode, EmailImmediate, time.Now().Add(-throttle))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claimed []NotificationEmail
+	for rows.Next() {
+		var e NotificationEmail
+		if err := rows.Scan(&e.ID, &e.UserID); err != nil {
+			return nil, err
+		}
+
+		claimed = append(claimed, e)
+	}
+
+	return claimed, rows.Err()
+}
+
+// GetById returns the notification id of userId, ErrorNotFound when it has no
+// actors left.
+func (s *PostgresNotificationsStore) GetById(ctx context.Context, userId int64, id int64) (*Notification, error) {
+	query := `
+	SELECT n.id, n.kind, n.post_id, n.comment_id, a.actor_count, a.actor_ids, a.actor_names,
+	n.read_at IS NOT NULL, n.created_at, n.updated_at
+	FROM notifications n
+	CROSS JOIN LATERAL (` + notificationActors + `) a
+	WHERE n.user_id = $1 AND n.id = $2 AND a.actor_count > 0
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications, err := scanNotifications(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(notifications) == 0 {
+		return nil, ErrorNotFound
+	}
+
+	return &notifications[0], nil
+}
+
+func scanNotifications(rows *sql.Rows) ([]Notification, error) {
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		var actorIds []int64
+		var actorNames []string
+
+		err := rows.Scan(
+			&n.ID,
+			&n.Kind,
+			&n.PostID,
+			&n.CommentID,
+			&n.ActorCount,
+			pq.Array(&actorIds),
+			pq.Array(&actorNames),
+			&n.Read,
+			&n.CreatedAt,
+			&n.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		n.Actors = make([]NotificationActor, len(actorIds))
+		for i := range actorIds {
+			n.Actors[i] = NotificationActor{ID: actorIds[i], Username: actorNames[i]}
+		}
+
+		notifications = append(notifications, n)
+	}
+
+	return notifications, rows.Err()
+}
+
+// CountUnread returns how many unread notifications of each kind userId has,
+// leaving out like Get those none of whose actors can be shown.
+func (s *PostgresNotificationsStore) CountUnread(ctx context.Context, userId int64) (map[string]int, error) {
+	query := `
+	SELECT n.kind, COUNT(*)
+	FROM notifications n
+	CROSS JOIN LATERAL (` + notificationActors + `) a
+	WHERE n.user_id = $1 AND n.read_at IS NULL AND a.actor_count > 0
+	GROUP BY n.kind
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var kind string
+		var count int
+		if err := rows.Scan(&kind, &count); err != nil {
+			return nil, err
+		}
+
+		counts[kind] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// MarkRead marks notification id of userId as read, marking a read one again
+// keeps its original read time.
+func (s *PostgresNotificationsStore) MarkRead(ctx context.Context, userId int64, id int64) error {
+	query := `UPDATE notifications SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+// MarkAllRead marks every unread notification of userId as read and returns how many there were.
+func (s *PostgresNotificationsStore) MarkAllRead(ctx context.Context, userId int64) (int64, error) {
+	query := `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
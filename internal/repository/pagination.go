@@ -1,14 +1,32 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/entities"
+	"github.com/lib/pq"
 )
 
+// Cursor marks the last row of a page in listings ordered by a timestamp and id.
+type Cursor struct {
+	At time.Time `json:"at"`
+	ID int64     `json:"id"`
+}
+
 type PaginatedFeedQuery struct {
-	Limit  int    `json:"limit" validate:"gte=1,lte=20"`
-	Offset int    `json:"offset" validate:"gte=0"`
-	Sort   string `json:"sort" validate:"oneof=asc desc"`
+	Limit  int        `json:"limit" validate:"gte=1,lte=20"`
+	Offset int        `json:"offset" validate:"gte=0"`
+	Sort   string     `json:"sort" validate:"oneof=asc desc"`
+	Tags   []string   `json:"tags" validate:"max=5"`
+	Search string     `json:"search" validate:"max=100"`
+	Since  *time.Time `json:"since"`
+	Until  *time.Time `json:"until"`
+	Cursor *Cursor    `json:"-"`
 }
 
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
@@ -18,7 +36,7 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	if limit != "" {
 		l, err := strconv.Atoi(limit)
 		if err != nil {
-			return fq, nil
+			return fq, fmt.Errorf("invalid limit %q", limit)
 		}
 
 		fq.Limit = l
@@ -28,7 +46,7 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	if offset != "" {
 		l, err := strconv.Atoi(offset)
 		if err != nil {
-			return fq, nil
+			return fq, fmt.Errorf("invalid offset %q", offset)
 		}
 
 		fq.Offset = l
@@ -39,5 +57,119 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 		fq.Sort = sort
 	}
 
+	tags := qs.Get("tags")
+	if tags != "" {
+		fq.Tags = nil
+		for _, tag := range strings.Split(tags, ",") {
+			normalized := entities.NormalizeTag(tag)
+			if normalized == "" {
+				return fq, fmt.Errorf("invalid tag %q", tag)
+			}
+
+			fq.Tags = append(fq.Tags, normalized)
+		}
+	}
+
+	fq.Search = strings.TrimSpace(qs.Get("search"))
+
+	since := qs.Get("since")
+	if since != "" {
+		t, err := parseTime(since)
+		if err != nil {
+			return fq, fmt.Errorf("invalid since %q: %w", since, err)
+		}
+
+		fq.Since = &t
+	}
+
+	until := qs.Get("until")
+	if until != "" {
+		t, err := parseTime(until)
+		if err != nil {
+			return fq, fmt.Errorf("invalid until %q: %w", until, err)
+		}
+
+		fq.Until = &t
+	}
+
+	if fq.Since != nil && fq.Until != nil && !fq.Since.Before(*fq.Until) {
+		return fq, errors.New("since must be before until")
+	}
+
 	return fq, nil
 }
+
+// parseTime accepts full RFC 3339 timestamps or plain dates, taken as midnight UTC.
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return t, errors.New("expected an RFC 3339 timestamp or a YYYY-MM-DD date")
+	}
+
+	return t, nil
+}
+
+// keyset returns the condition that resumes a listing ordered by (atColumn, idColumn)
+// right after fq.Cursor, with placeholders numbered from argPos. Without a cursor
+// it matches every row.
+func (fq PaginatedFeedQuery) keyset(atColumn, idColumn string, argPos int) (string, []any) {
+	if fq.Cursor == nil {
+		return "TRUE", nil
+	}
+
+	op := "<"
+	if fq.Sort == "asc" {
+		op = ">"
+	}
+
+	cond := fmt.Sprintf("(%s, %s) %s ($%d, $%d)", atColumn, idColumn, op, argPos, argPos+1)
+	return cond, []any{fq.Cursor.At, fq.Cursor.ID}
+}
+
+// filters returns the conditions for the tags, search and date range of fq on the
+// posts table aliased as alias, with placeholders numbered from argPos. Tags match
+// any of the given ones through idx_posts_tags and search goes through the trigram
+// indexes on title and content.
+func (fq PaginatedFeedQuery) filters(alias string, argPos int) (string, []any) {
+	if alias != "" {
+		alias += "."
+	}
+
+	conds := []string{"TRUE"}
+	var args []any
+
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", argPos+len(args)-1)
+	}
+
+	if len(fq.Tags) > 0 {
+		conds = append(conds, fmt.Sprintf("%stags && %s::varchar(100)[]", alias, arg(pq.Array(fq.Tags))))
+	}
+
+	if fq.Search != "" {
+		pattern := arg("%" + likeEscaper.Replace(fq.Search) + "%")
+		conds = append(conds, fmt.Sprintf("(%stitle ILIKE %s OR %scontent ILIKE %s)", alias, pattern, alias, pattern))
+	}
+
+	if fq.Since != nil {
+		conds = append(conds, fmt.Sprintf("%screated_at >= %s", alias, arg(*fq.Since)))
+	}
+
+	if fq.Until != nil {
+		conds = append(conds, fmt.Sprintf("%screated_at < %s", alias, arg(*fq.Until)))
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Filtered reports whether fq narrows the listing by tags, search text or dates.
+func (fq PaginatedFeedQuery) Filtered() bool {
+	return len(fq.Tags) > 0 || fq.Search != "" || fq.Since != nil || fq.Until != nil
+}
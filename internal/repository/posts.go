@@ -4,21 +4,47 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/carlosEA28/Social/internal/entities"
+	"github.com/carlosEA28/Social/internal/ranking"
 	"github.com/lib/pq"
 )
 
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
 type Post struct {
-	ID        int64     `json:"id"`
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	UserId    int64     `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Version   int       `json:"version"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"user"`
+	ID      int64    `json:"id"`
+	Content string   `json:"content"`
+	Title   string   `json:"title"`
+	UserId  int64    `json:"user_id"`
+	Tags    []string `json:"tags"`
+	// ExplicitTags are the tags the author set, Tags adds those of the hashtags in
+	// Content. It is nil for posts written before the two were kept apart.
+	ExplicitTags []string       `json:"-"`
+	Status       string         `json:"status"`
+	PublishAt    *time.Time     `json:"publish_at"`
+	CreatedAt    string         `json:"created_at"`
+	UpdatedAt    string         `json:"updated_at"`
+	Version      int            `json:"version"`
+	EditedAt     *time.Time     `json:"edited_at"`
+	Edited       bool           `json:"edited"`
+	DeletedAt    *time.Time     `json:"deleted_at,omitempty"`
+	DeletedBy    *int64         `json:"deleted_by,omitempty"`
+	Comments     []Comment      `json:"comments"`
+	Attachments  []Attachment   `json:"attachments"`
+	Reactions    map[string]int `json:"reactions"`
+	Entities     Entities       `json:"entities"`
+	User         User           `json:"user"`
+}
+
+func (p *Post) IsPublished() bool {
+	return p.Status == PostStatusPublished
 }
 
 type PostWithMetadata struct {
@@ -30,33 +56,38 @@ type PostgresPostsStore struct {
 	db *sql.DB
 }
 
+// GetUserFeed returns the home timeline of userId: the published posts of the
+// accounts they follow plus their own, newest first unless fq asks otherwise.
 func (s *PostgresPostsStore) GetUserFeed(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	keyset, args := fq.keyset("p.created_at", "p.id", 4)
+	filters, filterArgs := fq.filters("p", 4+len(args))
+	args = append(args, filterArgs...)
+
 	query := `
 SELECT 
-p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.edited_at,
 u.username,
-COUNT(c.id) AS comments_count
+(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count
 FROM posts p
-LEFT JOIN comments c ON c.post_id = p.id
-LEFT JOIN users u ON p.user_id = u.id
-JOIN followers f ON f.follower_id = p.user_id
-WHERE f.follower_id = $1 
-GROUP BY p.id, u.username
-ORDER BY p.created_at ` + fq.Sort + `
+JOIN users u ON p.user_id = u.id
+WHERE (p.user_id = $1 OR p.user_id IN (SELECT f.user_id FROM followers f WHERE f.follower_id = $1))
+AND p.status = 'published' AND p.deleted_at IS NULL AND ` + notMuted("p.user_id", "$1") + `
+AND ` + keyset + ` AND ` + filters + `
+ORDER BY p.created_at ` + fq.Sort + `, p.id ` + fq.Sort + `
 LIMIT $2 OFFSET $3
 `
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userId, fq.Limit, fq.Offset)
+	rows, err := s.db.QueryContext(ctx, query, append([]any{userId, fq.Limit, fq.Offset}, args...)...)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	var feed []PostWithMetadata
+	feed := []PostWithMetadata{}
 
 	for rows.Next() {
 		var posts PostWithMetadata
@@ -68,6 +99,7 @@ LIMIT $2 OFFSET $3
 			&posts.CreatedAt,
 			&posts.Version,
 			pq.Array(&posts.Tags),
+			&posts.EditedAt,
 			&posts.User.Username,
 			&posts.CommentCount,
 		)
@@ -75,19 +107,42 @@ LIMIT $2 OFFSET $3
 			return nil, err
 		}
 
+		posts.Edited = posts.EditedAt != nil
+		posts.User.ID = posts.UserId
+
 		feed = append(feed, posts)
 	}
 
-	return feed, nil
+	return feed, rows.Err()
 }
 
 func (s *PostgresPostsStore) Create(ctx context.Context, post *Post) error {
-	query := `INSERT INTO  posts(content, title, user_id, tags) VALUES($1,$2,$3,$4) RETURNING id, created_at,updated_at`
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.create(ctx, tx, post); err != nil {
+			return err
+		}
+
+		mentions, err := replaceMentions(ctx, tx, "post_id", post.ID, post.UserId, post.Content)
+		if err != nil {
+			return err
+		}
+
+		post.Entities.Mentions = mentions
+		return nil
+	})
+}
+
+func (s *PostgresPostsStore) create(ctx context.Context, tx *sql.Tx, post *Post) error {
+	query := `INSERT INTO  posts(content, title, user_id, tags, status, publish_at, explicit_tags) VALUES($1,$2,$3,$4,$5,$6,$7) RETURNING id, created_at,updated_at`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query, post.Content, post.Title, post.UserId, pq.Array(post.Tags)).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
+	if post.Status == "" {
+		post.Status = PostStatusPublished
+	}
+
+	err := tx.QueryRowContext(ctx, query, post.Content, post.Title, post.UserId, pq.Array(post.Tags), post.Status, post.PublishAt, pq.Array(post.ExplicitTags)).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
 
 	if err != nil {
 		return err
@@ -97,7 +152,7 @@ func (s *PostgresPostsStore) Create(ctx context.Context, post *Post) error {
 }
 
 func (s *PostgresPostsStore) GetById(ctx context.Context, id int64) (*Post, error) {
-	query := `SELECT id,user_id,title,content,created_at,updated_at,tags,version FROM posts WHERE id = $1`
+	query := `SELECT id,user_id,title,content,created_at,updated_at,tags,version,status,publish_at,edited_at,explicit_tags FROM posts WHERE id = $1 AND deleted_at IS NULL`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
@@ -112,6 +167,10 @@ func (s *PostgresPostsStore) GetById(ctx context.Context, id int64) (*Post, erro
 		&post.UpdatedAt,
 		pq.Array(&post.Tags),
 		&post.Version,
+		&post.Status,
+		&post.PublishAt,
+		&post.EditedAt,
+		pq.Array(&post.ExplicitTags),
 	)
 
 	if err != nil {
@@ -123,11 +182,38 @@ func (s *PostgresPostsStore) GetById(ctx context.Context, id int64) (*Post, erro
 		}
 	}
 
+	post.Edited = post.EditedAt != nil
+
 	return &post, nil
 }
 
-func (s *PostgresPostsStore) Delete(ctx context.Context, postId int64) error {
-	query := `DELETE FROM posts WHERE id = $1`
+// Delete moves the post to the trash, it is only removed for good by PurgeDeleted.
+// The post is unpinned, restoring it doesn't pin it again.
+func (s *PostgresPostsStore) Delete(ctx context.Context, postId int64, deletedBy int64) error {
+	query := `UPDATE posts SET deleted_at = NOW(), deleted_by = $2, pinned_at = NULL WHERE id = $1 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	response, err := s.db.ExecContext(ctx, query, postId, deletedBy)
+	if err != nil {
+		return err
+	}
+
+	rows, err := response.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresPostsStore) Restore(ctx context.Context, postId int64) error {
+	query := `UPDATE posts SET deleted_at = NULL, deleted_by = NULL WHERE id = $1 AND deleted_at IS NOT NULL`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
@@ -148,26 +234,919 @@ func (s *PostgresPostsStore) Delete(ctx context.Context, postId int64) error {
 
 	return nil
 }
+
+func (s *PostgresPostsStore) GetDeletedById(ctx context.Context, id int64) (*Post, error) {
+	query := `
+	SELECT id, user_id, title, content, created_at, updated_at, tags, version, status, publish_at, edited_at, deleted_at, deleted_by
+	FROM posts
+	WHERE id = $1 AND deleted_at IS NOT NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var post Post
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&post.ID,
+		&post.UserId,
+		&post.Title,
+		&post.Content,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		pq.Array(&post.Tags),
+		&post.Version,
+		&post.Status,
+		&post.PublishAt,
+		&post.EditedAt,
+		&post.DeletedAt,
+		&post.DeletedBy,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	post.Edited = post.EditedAt != nil
+
+	return &post, nil
+}
+
+// GetTrash lists soft-deleted posts owned by userId, a zero userId lists everyone's trash.
+func (s *PostgresPostsStore) GetTrash(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]Post, error) {
+	keyset, args := fq.keyset("deleted_at", "id", 4)
+	filters, filterArgs := fq.filters("", 4+len(args))
+	args = append(args, filterArgs...)
+
+	query := `
+	SELECT id, user_id, title, content, created_at, updated_at, tags, version, status, publish_at, edited_at, deleted_at, deleted_by
+	FROM posts
+	WHERE deleted_at IS NOT NULL AND ($1::bigint = 0 OR user_id = $1) AND ` + keyset + ` AND ` + filters + `
+	ORDER BY deleted_at ` + fq.Sort + `, id ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{userId, fq.Limit, fq.Offset}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trash := []Post{}
+	for rows.Next() {
+		var post Post
+		err := rows.Scan(
+			&post.ID,
+			&post.UserId,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			pq.Array(&post.Tags),
+			&post.Version,
+			&post.Status,
+			&post.PublishAt,
+			&post.EditedAt,
+			&post.DeletedAt,
+			&post.DeletedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		post.Edited = post.EditedAt != nil
+		trash = append(trash, post)
+	}
+
+	return trash, rows.Err()
+}
+
+// PurgeDeleted hard-deletes posts that have been in the trash since before cutoff,
+// their comments and revisions go with them through the foreign key cascades. It
+// returns how many posts it removed and the blob keys of their attachments, which
+// are left for the caller to delete. A post restored while this runs is either
+// purged with its keys or kept with its blobs, never half of each.
+func (s *PostgresPostsStore) PurgeDeleted(ctx context.Context, cutoff time.Time) (int64, []string, error) {
+	// the attachments of the purged posts are still visible to the select, their
+	// cascaded delete only happens at the end of the statement
+	query := `
+	WITH purged AS (
+		DELETE FROM posts WHERE deleted_at < $1 RETURNING id
+	)
+	SELECT p.id, a.storage_key, a.thumbnail_key
+	FROM purged p
+	LEFT JOIN post_attachments a ON a.post_id = p.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	purged := map[int64]bool{}
+	var keys []string
+	for rows.Next() {
+		var id int64
+		var key, thumbnailKey *string
+		if err := rows.Scan(&id, &key, &thumbnailKey); err != nil {
+			return 0, nil, err
+		}
+
+		purged[id] = true
+		if key != nil {
+			keys = append(keys, *key)
+		}
+		if thumbnailKey != nil {
+			keys = append(keys, *thumbnailKey)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	return int64(len(purged)), keys, nil
+}
+
 func (s *PostgresPostsStore) Update(ctx context.Context, post *Post) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := createRevision(ctx, tx, post.ID, post.Version); err != nil {
+			return err
+		}
+
+		if err := s.update(ctx, tx, post); err != nil {
+			return err
+		}
+
+		mentions, err := replaceMentions(ctx, tx, "post_id", post.ID, post.UserId, post.Content)
+		if err != nil {
+			return err
+		}
+
+		post.Entities.Mentions = mentions
+		return nil
+	})
+}
+
+func (s *PostgresPostsStore) update(ctx context.Context, tx *sql.Tx, post *Post) error {
+	// a draft that gets published surfaces in feeds at the time it was published,
+	// only changes made after that count as edits, and a post that is unpublished
+	// is unpinned
 	query := `
 	UPDATE posts
-	SET title = $1, content = $2 , version = version + 1
-	WHERE ID = $3 AND version = $4
-	RETURNING version
+	SET title = $1, content = $2, status = $3, publish_at = $4, tags = $5, explicit_tags = $8, version = version + 1,
+		created_at = CASE WHEN status <> 'published' AND $3 = 'published' THEN NOW() ELSE created_at END,
+		edited_at = CASE WHEN status = 'published' THEN NOW() ELSE edited_at END,
+		pinned_at = CASE WHEN $3 = 'published' THEN pinned_at END
+	WHERE ID = $6 AND version = $7 AND deleted_at IS NULL
+	RETURNING version, created_at, edited_at
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query, post.Title, post.Content, post.ID, post.Version).Scan(&post.Version)
+	err := tx.QueryRowContext(ctx, query, post.Title, post.Content, post.Status, post.PublishAt, pq.Array(post.Tags), post.ID, post.Version, pq.Array(post.ExplicitTags)).Scan(&post.Version, &post.CreatedAt, &post.EditedAt)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrorNotFound
+			return editConflictOrNotFound(ctx, tx, post.ID)
 		default:
 			return err
 		}
 	}
 
+	post.Edited = post.EditedAt != nil
+
+	return nil
+}
+
+func (s *PostgresPostsStore) GetDrafts(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]Post, error) {
+	keyset, args := fq.keyset("created_at", "id", 4)
+	filters, filterArgs := fq.filters("", 4+len(args))
+	args = append(args, filterArgs...)
+
+	query := `
+	SELECT id, user_id, title, content, created_at, updated_at, tags, version, status, publish_at
+	FROM posts
+	WHERE user_id = $1 AND status IN ('draft', 'scheduled') AND deleted_at IS NULL AND ` + keyset + ` AND ` + filters + `
+	ORDER BY created_at ` + fq.Sort + `, id ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{userId, fq.Limit, fq.Offset}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drafts := []Post{}
+	for rows.Next() {
+		var post Post
+		err := rows.Scan(
+			&post.ID,
+			&post.UserId,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			pq.Array(&post.Tags),
+			&post.Version,
+			&post.Status,
+			&post.PublishAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		drafts = append(drafts, post)
+	}
+
+	return drafts, rows.Err()
+}
+
+// PublishDue publishes up to limit scheduled posts whose publish_at has passed.
+// Rows are claimed with FOR UPDATE SKIP LOCKED so concurrent API instances never
+// publish the same post twice.
+func (s *PostgresPostsStore) PublishDue(ctx context.Context, limit int) ([]Post, error) {
+	query := `
+	UPDATE posts
+	SET status = 'published', created_at = NOW(), updated_at = NOW()
+	WHERE status = 'scheduled' AND id IN (
+		SELECT id FROM posts
+		WHERE status = 'scheduled' AND publish_at <= NOW() AND deleted_at IS NULL
+		ORDER BY publish_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, user_id, title, content, created_at, updated_at, tags, version, status, publish_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var published []Post
+	for rows.Next() {
+		var post Post
+		err := rows.Scan(
+			&post.ID,
+			&post.UserId,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			pq.Array(&post.Tags),
+			&post.Version,
+			&post.Status,
+			&post.PublishAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		published = append(published, post)
+	}
+
+	return published, rows.Err()
+}
+
+// NormalizeLegacyTags fills in the explicit tags of up to limit posts written
+// before they were kept apart from hashtags, and normalizes their tags the way
+// new posts are. All the tags of those posts count as explicit, it returns how
+// many posts it went through.
+func (s *PostgresPostsStore) NormalizeLegacyTags(ctx context.Context, limit int) (int, error) {
+	var normalized int
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		query := `
+		SELECT id, tags, content FROM posts
+		WHERE explicit_tags IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+		`
+
+		rows, err := tx.QueryContext(ctx, query, limit)
+		if err != nil {
+			return err
+		}
+
+		var posts []Post
+		for rows.Next() {
+			var post Post
+			if err := rows.Scan(&post.ID, pq.Array(&post.Tags), &post.Content); err != nil {
+				rows.Close()
+				return err
+			}
+
+			posts = append(posts, post)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		query = `UPDATE posts SET explicit_tags = $2, tags = $3 WHERE id = $1`
+
+		for _, post := range posts {
+			explicit := entities.MergeTags(post.Tags, "")
+			tags := entities.MergeTags(explicit, post.Content)
+
+			if _, err := tx.ExecContext(ctx, query, post.ID, pq.Array(explicit), pq.Array(tags)); err != nil {
+				return err
+			}
+		}
+
+		normalized = len(posts)
+		return nil
+	})
+
+	return normalized, err
+}
+
+// GetMentioning lists the published posts whose content mentions userId.
+func (s *PostgresPostsStore) GetMentioning(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	keyset, args := fq.keyset("p.created_at", "p.id", 4)
+	filters, filterArgs := fq.filters("p", 4+len(args))
+	args = append(args, filterArgs...)
+
+	query := `
+	SELECT
+	p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.edited_at,
+	u.username,
+	(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	WHERE p.status = 'published' AND p.deleted_at IS NULL
+	AND EXISTS (SELECT 1 FROM mentions m WHERE m.post_id = p.id AND m.user_id = $1)
+	AND ` + visibleAuthor("p.user_id", "$1") + ` AND ` + keyset + ` AND ` + filters + `
+	ORDER BY p.created_at ` + fq.Sort + `, p.id ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{userId, fq.Limit, fq.Offset}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var post PostWithMetadata
+		err := rows.Scan(
+			&post.ID,
+			&post.UserId,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.EditedAt,
+			&post.User.Username,
+			&post.CommentCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		post.Edited = post.EditedAt != nil
+		post.User.ID = post.UserId
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+// GetByTag lists the published posts tagged with tag, which must already be
+// normalized, that viewerId can see.
+func (s *PostgresPostsStore) GetByTag(ctx context.Context, tag string, viewerId int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	keyset, args := fq.keyset("p.created_at", "p.id", 5)
+	filters, filterArgs := fq.filters("p", 5+len(args))
+	args = append(args, filterArgs...)
+
+	query := `
+	SELECT
+	p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.edited_at,
+	u.username,
+	(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	WHERE p.status = 'published' AND p.deleted_at IS NULL
+	AND p.tags @> ARRAY[$1]::varchar(100)[]
+	AND ` + visibleAuthor("p.user_id", "$4") + ` AND ` + keyset + ` AND ` + filters + `
+	ORDER BY p.created_at ` + fq.Sort + `, p.id ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{tag, fq.Limit, fq.Offset, viewerId}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var post PostWithMetadata
+		err := rows.Scan(
+			&post.ID,
+			&post.UserId,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.EditedAt,
+			&post.User.Username,
+			&post.CommentCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		post.Edited = post.EditedAt != nil
+		post.User.ID = post.UserId
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+// GetTimelineEntries lists the published posts of authorIds as timeline entries,
+// newest first, for the timelines that are filled on read instead of on write.
+func (s *PostgresPostsStore) GetTimelineEntries(ctx context.Context, authorIds []int64, fq PaginatedFeedQuery) ([]TimelineEntry, error) {
+	fq.Sort = "desc"
+	keyset, args := fq.keyset("created_at", "id", 3)
+
+	query := `
+	SELECT id, user_id, created_at
+	FROM posts
+	WHERE user_id = ANY($1) AND status = 'published' AND deleted_at IS NULL AND ` + keyset + `
+	ORDER BY created_at DESC, id DESC
+	LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{pq.Array(authorIds), fq.Limit}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []TimelineEntry{}
+	for rows.Next() {
+		var e TimelineEntry
+		if err := rows.Scan(&e.PostID, &e.AuthorID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetFeedByIds loads the posts of a materialized timeline page in the order of ids.
+// Posts deleted, unpublished, hidden from viewerId or muted by them since they
+// were pushed are left out.
+func (s *PostgresPostsStore) GetFeedByIds(ctx context.Context, ids []int64, viewerId int64) ([]PostWithMetadata, error) {
+	query := `
+	SELECT
+	p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.edited_at,
+	u.username,
+	(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count
+	FROM unnest($1::bigint[]) WITH ORDINALITY AS t(id, position)
+	JOIN posts p ON p.id = t.id
+	JOIN users u ON u.id = p.user_id
+	WHERE p.status = 'published' AND p.deleted_at IS NULL
+	AND ` + visibleAuthor("p.user_id", "$2") + ` AND ` + notMuted("p.user_id", "$2") + `
+	ORDER BY t.position
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids), viewerId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var post PostWithMetadata
+		err := rows.Scan(
+			&post.ID,
+			&post.UserId,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.EditedAt,
+			&post.User.Username,
+			&post.CommentCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		post.Edited = post.EditedAt != nil
+		post.User.ID = post.UserId
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+// GetRankingCandidates gathers the published posts created in [since, until) by
+// userId, the accounts they follow and the accounts those follow, with the
+// engagement counts the ranked feed scores them by. Only the filters of fq apply,
+// the ordering is left to the ranking.
+func (s *PostgresPostsStore) GetRankingCandidates(ctx context.Context, userId int64, fq PaginatedFeedQuery, since, until time.Time, limit int) ([]ranking.Candidate, error) {
+	filters, args := fq.filters("p", 5)
+
+	query := `
+	WITH followed AS (
+		SELECT user_id FROM followers WHERE follower_id = $1
+	), second_degree AS (
+		SELECT DISTINCT f.user_id FROM followers f
+		WHERE f.follower_id IN (SELECT user_id FROM followed)
+		AND f.user_id <> $1 AND f.user_id NOT IN (SELECT user_id FROM followed)
+	), affinity AS (
+		SELECT p.user_id, COUNT(*) AS interactions
+		FROM (
+			SELECT post_id FROM comments WHERE user_id = $1 AND created_at > $3::timestamptz - INTERVAL '30 days'
+			UNION ALL
+			SELECT post_id FROM post_reactions WHERE user_id = $1 AND created_at > $3::timestamptz - INTERVAL '30 days'
+		) i
+		JOIN posts p ON p.id = i.post_id
+		GROUP BY p.user_id
+	)
+	SELECT
+	p.id, p.user_id, p.created_at,
+	CASE WHEN p.user_id = $1 THEN 0 WHEN p.user_id IN (SELECT user_id FROM followed) THEN 1 ELSE 2 END AS degree,
+	(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+	(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id) AS reactions_count,
+	COALESCE(a.interactions, 0) AS affinity
+	FROM posts p
+	LEFT JOIN affinity a ON a.user_id = p.user_id
+	WHERE (p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followed) OR p.user_id IN (SELECT user_id FROM second_degree))
+	AND p.status = 'published' AND p.deleted_at IS NULL
+	AND ` + visibleAuthor("p.user_id", "$1") + ` AND ` + notMuted("p.user_id", "$1") + `
+	AND p.created_at >= $2 AND p.created_at < $3 AND ` + filters + `
+	ORDER BY p.created_at DESC, p.id DESC
+	LIMIT $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{userId, since, until, limit}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []ranking.Candidate{}
+	for rows.Next() {
+		var c ranking.Candidate
+		err := rows.Scan(
+			&c.PostID,
+			&c.AuthorID,
+			&c.CreatedAt,
+			&c.Degree,
+			&c.Comments,
+			&c.Reactions,
+			&c.Affinity,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	return candidates, rows.Err()
+}
+
+// GetTopFollowed returns the ids of up to limit posts published since since by
+// the accounts userId follows, the most commented and reacted to first.
+func (s *PostgresPostsStore) GetTopFollowed(ctx context.Context, userId int64, since time.Time, limit int) ([]int64, error) {
+	query := `
+	SELECT p.id
+	FROM posts p
+	JOIN followers f ON f.user_id = p.user_id AND f.follower_id = $1
+	WHERE p.status = 'published' AND p.deleted_at IS NULL AND p.created_at >= $2
+	AND ` + visibleAuthor("p.user_id", "$1") + ` AND ` + notMuted("p.user_id", "$1") + `
+	ORDER BY
+	(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) +
+	(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id) DESC,
+	p.id DESC
+	LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// MaxPinnedPosts is how many posts a user can pin to their profile.
+const MaxPinnedPosts = 3
+
+var ErrorPinLimit = fmt.Errorf("at most %d posts can be pinned", MaxPinnedPosts)
+
+// ProfileEntry is an item of a profile timeline: a post of the user or, for
+// replies, a comment of theirs along with the post it is on.
+type ProfileEntry struct {
+	Type      string            `json:"type"`
+	Post      *PostWithMetadata `json:"post"`
+	Reply     *Comment          `json:"reply,omitempty"`
+	CreatedAt string            `json:"created_at"`
+	// SortKey breaks ties between entries created at the same time. Posts and
+	// comments number their ids apart, so posts get 2*id and comments 2*id+1.
+	SortKey int64 `json:"-"`
+}
+
+const (
+	ProfileEntryPost  = "post"
+	ProfileEntryReply = "reply"
+)
+
+// GetProfileTimeline lists what authorId published that viewerId can see, most
+// recent first. withReplies mixes in their comments on posts viewerId can see,
+// mediaOnly keeps only the posts with attachments. The filters of fq narrow the
+// posts, replies are listed unfiltered.
+func (s *PostgresPostsStore) GetProfileTimeline(ctx context.Context, authorId, viewerId int64, withReplies, mediaOnly bool, fq PaginatedFeedQuery) ([]ProfileEntry, error) {
+	keyset, args := fq.keyset("e.created_at", "e.sort_key", 7)
+	filters, filterArgs := fq.filters("p", 7+len(args))
+	args = append(args, filterArgs...)
+
+	query := `
+	WITH entries AS (
+		SELECT p.id AS post_id, NULL::bigint AS comment_id, p.created_at, p.id * 2 AS sort_key
+		FROM posts p
+		WHERE p.user_id = $1 AND p.status = 'published' AND p.deleted_at IS NULL
+		AND (NOT $6 OR EXISTS (SELECT 1 FROM post_attachments a WHERE a.post_id = p.id))
+		AND ` + filters + `
+		UNION ALL
+		SELECT c.post_id, c.id, c.created_at, c.id * 2 + 1
+		FROM comments c
+		JOIN posts cp ON cp.id = c.post_id
+		WHERE $5 AND NOT $6 AND c.user_id = $1 AND cp.status = 'published' AND cp.deleted_at IS NULL
+		AND ` + visibleAuthor("cp.user_id", "$4") + `
+	)
+	SELECT
+	e.sort_key, e.created_at,
+	p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.edited_at,
+	u.username,
+	(SELECT COUNT(*) FROM comments pc WHERE pc.post_id = p.id) AS comments_count,
+	c.id, c.parent_id, c.content, c.created_at, c.edited_at
+	FROM entries e
+	JOIN posts p ON p.id = e.post_id
+	JOIN users u ON u.id = p.user_id
+	LEFT JOIN comments c ON c.id = e.comment_id
+	WHERE ` + visibleAuthor("$1::bigint", "$4") + ` AND ` + keyset + `
+	ORDER BY e.created_at ` + fq.Sort + `, e.sort_key ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{authorId, fq.Limit, fq.Offset, viewerId, withReplies, mediaOnly}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ProfileEntry{}
+	for rows.Next() {
+		var e ProfileEntry
+		var post PostWithMetadata
+		var reply struct {
+			ID        *int64
+			ParentID  *int64
+			Content   *string
+			CreatedAt *string
+			EditedAt  *time.Time
+		}
+
+		err := rows.Scan(
+			&e.SortKey,
+			&e.CreatedAt,
+			&post.ID,
+			&post.UserId,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.EditedAt,
+			&post.User.Username,
+			&post.CommentCount,
+			&reply.ID,
+			&reply.ParentID,
+			&reply.Content,
+			&reply.CreatedAt,
+			&reply.EditedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		post.Edited = post.EditedAt != nil
+		post.User.ID = post.UserId
+		e.Post = &post
+		e.Type = ProfileEntryPost
+
+		if reply.ID != nil {
+			e.Type = ProfileEntryReply
+			e.Reply = &Comment{
+				ID:        *reply.ID,
+				PostID:    post.ID,
+				ParentID:  reply.ParentID,
+				UserID:    authorId,
+				Content:   *reply.Content,
+				CreatedAt: *reply.CreatedAt,
+				EditedAt:  reply.EditedAt,
+			}
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetPinned lists the posts authorId pinned to their profile, the most recently
+// pinned first, as long as viewerId can see them.
+func (s *PostgresPostsStore) GetPinned(ctx context.Context, authorId, viewerId int64) ([]PostWithMetadata, error) {
+	query := `
+	SELECT
+	p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.edited_at,
+	u.username,
+	(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	WHERE p.user_id = $1 AND p.pinned_at IS NOT NULL AND p.status = 'published' AND p.deleted_at IS NULL
+	AND ` + visibleAuthor("p.user_id", "$2") + `
+	ORDER BY p.pinned_at DESC, p.id DESC
+	LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, authorId, viewerId, MaxPinnedPosts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var post PostWithMetadata
+		err := rows.Scan(
+			&post.ID,
+			&post.UserId,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.EditedAt,
+			&post.User.Username,
+			&post.CommentCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		post.Edited = post.EditedAt != nil
+		post.User.ID = post.UserId
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+// Pin pins post to the profile of its author, failing with ErrorPinLimit when
+// they already have MaxPinnedPosts pinned. Pinning a pinned post again is a no-op.
+// Deleting or unpublishing a post unpins it, so only published posts count
+// towards the limit.
+func (s *PostgresPostsStore) Pin(ctx context.Context, post *Post) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		// serializes the pins of the author so two at once can't both pass the limit
+		if _, err := tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, post.UserId); err != nil {
+			return err
+		}
+
+		query := `
+		SELECT COUNT(*) FROM posts
+		WHERE user_id = $1 AND pinned_at IS NOT NULL AND status = 'published' AND deleted_at IS NULL AND id <> $2
+		`
+
+		var pinned int
+		if err := tx.QueryRowContext(ctx, query, post.UserId, post.ID).Scan(&pinned); err != nil {
+			return err
+		}
+
+		if pinned >= MaxPinnedPosts {
+			return ErrorPinLimit
+		}
+
+		query = `
+		UPDATE posts SET pinned_at = COALESCE(pinned_at, NOW())
+		WHERE id = $1 AND status = 'published' AND deleted_at IS NULL
+		`
+
+		res, err := tx.ExecContext(ctx, query, post.ID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrorNotFound
+		}
+
+		return nil
+	})
+}
+
+func (s *PostgresPostsStore) Unpin(ctx context.Context, postId int64) error {
+	query := `UPDATE posts SET pinned_at = NULL WHERE id = $1 AND pinned_at IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, postId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorNotFound
+	}
+
 	return nil
 }
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type PostgresReactionsStore struct {
+	db *sql.DB
+}
+
+// Set records the reaction of userId to postId, replacing any previous one. It
+// reports whether userId had not reacted to postId before.
+func (s *PostgresReactionsStore) Set(ctx context.Context, postId int64, userId int64, kind string) (bool, error) {
+	query := `
+	INSERT INTO post_reactions (post_id, user_id, kind) VALUES ($1, $2, $3)
+	ON CONFLICT (post_id, user_id) DO UPDATE SET kind = EXCLUDED.kind, created_at = NOW()
+	RETURNING xmax = 0 -- only rows the insert created have no xmax
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var created bool
+	err := s.db.QueryRowContext(ctx, query, postId, userId, kind).Scan(&created)
+	return created, err
+}
+
+// Remove takes back the reaction of userId to postId, if there is one.
+func (s *PostgresReactionsStore) Remove(ctx context.Context, postId int64, userId int64) error {
+	query := `DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, postId, userId)
+	return err
+}
+
+// CountByPostIds returns the number of reactions of each kind on every post in ids.
+func (s *PostgresReactionsStore) CountByPostIds(ctx context.Context, ids []int64) (map[int64]map[string]int, error) {
+	query := `
+	SELECT post_id, kind, COUNT(*)
+	FROM post_reactions
+	WHERE post_id = ANY($1)
+	GROUP BY post_id, kind
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]map[string]int)
+	for rows.Next() {
+		var postId int64
+		var kind string
+		var count int
+		if err := rows.Scan(&postId, &kind, &count); err != nil {
+			return nil, err
+		}
+
+		if counts[postId] == nil {
+			counts[postId] = make(map[string]int)
+		}
+		counts[postId][kind] = count
+	}
+
+	return counts, rows.Err()
+}
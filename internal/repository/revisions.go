@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+type PostRevision struct {
+	ID        int64    `json:"id"`
+	PostID    int64    `json:"post_id"`
+	Version   int      `json:"version"`
+	Title     string   `json:"title"`
+	Content   string   `json:"content"`
+	Tags      []string `json:"tags"`
+	CreatedAt string   `json:"created_at"`
+}
+
+type PostgresRevisionsStore struct {
+	db *sql.DB
+}
+
+func (s *PostgresRevisionsStore) GetByPostId(ctx context.Context, postId int64) ([]PostRevision, error) {
+	query := `
+	SELECT id, post_id, version, title, content, tags, created_at
+	FROM post_revisions
+	WHERE post_id = $1
+	ORDER BY version DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		err := rows.Scan(&rev.ID, &rev.PostID, &rev.Version, &rev.Title, &rev.Content, pq.Array(&rev.Tags), &rev.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (s *PostgresRevisionsStore) GetByVersion(ctx context.Context, postId int64, version int) (*PostRevision, error) {
+	query := `
+	SELECT id, post_id, version, title, content, tags, created_at
+	FROM post_revisions
+	WHERE post_id = $1 AND version = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var rev PostRevision
+	err := s.db.QueryRowContext(ctx, query, postId, version).Scan(
+		&rev.ID,
+		&rev.PostID,
+		&rev.Version,
+		&rev.Title,
+		&rev.Content,
+		pq.Array(&rev.Tags),
+		&rev.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rev, nil
+}
+
+// createRevision snapshots the post as it is at version before it gets overwritten.
+// Another edit of the same version, whether it is still running or already
+// committed, fails it with ErrorEditConflict.
+func createRevision(ctx context.Context, tx *sql.Tx, postId int64, version int) error {
+	query := `
+	INSERT INTO post_revisions (post_id, version, title, content, tags)
+	SELECT id, version, title, content, tags FROM posts
+	WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, query, postId, version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "post_revisions_post_id_version_key"`:
+			return ErrorEditConflict
+		default:
+			return err
+		}
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return editConflictOrNotFound(ctx, tx, postId)
+	}
+
+	return nil
+}
+
+// editConflictOrNotFound tells why an edit of postId matched no row: the post
+// is at another version than the one edited, ErrorEditConflict, or it is gone,
+// ErrorNotFound.
+func editConflictOrNotFound(ctx context.Context, tx *sql.Tx, postId int64) error {
+	query := `SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1 AND deleted_at IS NULL)`
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, query, postId).Scan(&exists); err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrorEditConflict
+	}
+
+	return ErrorNotFound
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Snippets are HTML: the text of the author escaped, with the matched words in
+// <mark> tags. ts_headline works on the raw text, so it marks the words with
+// private use characters, stripped from the text beforehand, that only become
+// tags once the rest is escaped.
+const (
+	markStart       = "\uE000"
+	markStop        = "\uE001"
+	headlineOptions = `StartSel="` + markStart + `", StopSel="` + markStop + `", MaxWords=35, MinWords=15, MaxFragments=2`
+)
+
+var markReplacer = strings.NewReplacer(markStart, "<mark>", markStop, "</mark>")
+
+// headline returns the ts_headline of column for the query in m.query.
+func headline(column string) string {
+	return `ts_headline('english', translate(` + column + `, '` + markStart + markStop + `', ''), m.query, '` + headlineOptions + `')`
+}
+
+// highlight escapes a headline and turns its marks into <mark> tags.
+func highlight(headline string) string {
+	return markReplacer.Replace(html.EscapeString(headline))
+}
+
+type PostSearchResult struct {
+	PostWithMetadata
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+	Rank           float64 `json:"rank"`
+}
+
+type CommentSearchResult struct {
+	Comment
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+type UserSearchResult struct {
+	ID         int64   `json:"id"`
+	Username   string  `json:"username"`
+	CreatedAt  string  `json:"created_at"`
+	Similarity float64 `json:"similarity"`
+}
+
+type PostgresSearchStore struct {
+	db *sql.DB
+}
+
+// Posts matches q against the weighted search_vector of published posts, titles
+// weigh more than content and content more than tags. Only the limit, offset and
+// the tag and date filters of fq apply, results come most relevant first.
+func (s *PostgresSearchStore) Posts(ctx context.Context, q string, viewerId int64, fq PaginatedFeedQuery) ([]PostSearchResult, error) {
+	fq.Search = ""
+	filters, args := fq.filters("p", 5)
+
+	query := `
+	SELECT
+	m.id, m.user_id, m.title, m.content, m.created_at, m.version, m.tags, m.edited_at, m.username,
+	(SELECT COUNT(*) FROM comments c WHERE c.post_id = m.id) AS comments_count,
+	` + headline("m.title") + `,
+	` + headline("m.content") + `,
+	m.rank
+	FROM (
+		SELECT p.*, u.username, query, ts_rank(p.search_vector, query) AS rank
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		CROSS JOIN websearch_to_tsquery('english', $1) query
+		WHERE p.search_vector @@ query AND p.status = 'published' AND p.deleted_at IS NULL
+		AND ` + visibleAuthor("p.user_id", "$4") + ` AND ` + filters + `
+		ORDER BY rank DESC, p.id DESC
+		LIMIT $2 OFFSET $3
+	) m
+	ORDER BY m.rank DESC, m.id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{q, fq.Limit, fq.Offset, viewerId}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []PostSearchResult{}
+	for rows.Next() {
+		var result PostSearchResult
+		err := rows.Scan(
+			&result.ID,
+			&result.UserId,
+			&result.Title,
+			&result.Content,
+			&result.CreatedAt,
+			&result.Version,
+			pq.Array(&result.Tags),
+			&result.EditedAt,
+			&result.User.Username,
+			&result.CommentCount,
+			&result.TitleHighlight,
+			&result.Snippet,
+			&result.Rank,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Edited = result.EditedAt != nil
+		result.User.ID = result.UserId
+		result.TitleHighlight = highlight(result.TitleHighlight)
+		result.Snippet = highlight(result.Snippet)
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// Comments matches q against the comments of the published posts viewerId can
+// see, most relevant first.
+func (s *PostgresSearchStore) Comments(ctx context.Context, q string, viewerId int64, fq PaginatedFeedQuery) ([]CommentSearchResult, error) {
+	query := `
+	SELECT
+	m.id, m.post_id, m.user_id, m.content, m.created_at, m.username,
+	` + headline("m.content") + `,
+	m.rank
+	FROM (
+		SELECT c.*, u.username, query, ts_rank(c.search_vector, query) AS rank
+		FROM comments c
+		JOIN posts p ON p.id = c.post_id
+		JOIN users u ON u.id = c.user_id
+		CROSS JOIN websearch_to_tsquery('english', $1) query
+		WHERE c.search_vector @@ query AND p.status = 'published' AND p.deleted_at IS NULL
+		AND ` + visibleAuthor("p.user_id", "$4") + ` AND ` + notBlocked("c.user_id", "$4") + `
+		ORDER BY rank DESC, c.id DESC
+		LIMIT $2 OFFSET $3
+	) m
+	ORDER BY m.rank DESC, m.id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q, fq.Limit, fq.Offset, viewerId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []CommentSearchResult{}
+	for rows.Next() {
+		var result CommentSearchResult
+		err := rows.Scan(
+			&result.ID,
+			&result.PostID,
+			&result.UserID,
+			&result.Content,
+			&result.CreatedAt,
+			&result.User.Username,
+			&result.Snippet,
+			&result.Rank,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		result.User.ID = result.UserID
+		result.Snippet = highlight(result.Snippet)
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// Users finds active users whose username is similar to q through pg_trgm, so
+// typos still match, or starts with it, so short prefixes do too. Users blocked
+// either way with viewerId are left out.
+func (s *PostgresSearchStore) Users(ctx context.Context, q string, viewerId int64, fq PaginatedFeedQuery) ([]UserSearchResult, error) {
+	query := `
+	SELECT id, username, created_at, similarity(username, $1) AS score
+	FROM users
+	WHERE is_active = true AND (username % $1 OR username ILIKE $4) AND ` + notBlocked("users.id", "$5") + `
+	ORDER BY score DESC, id
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q, fq.Limit, fq.Offset, likeEscaper.Replace(q)+"%", viewerId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []UserSearchResult{}
+	for rows.Next() {
+		var result UserSearchResult
+		if err := rows.Scan(&result.ID, &result.Username, &result.CreatedAt, &result.Similarity); err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
@@ -5,12 +5,16 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	"github.com/carlosEA28/Social/internal/ranking"
+	"github.com/carlosEA28/Social/internal/stream"
 )
 
 var (
 	ErrorNotFound          = errors.New("resource not found")
 	ErrorDuplicateEmail    = errors.New("this email has already been registerd")
 	ErrorDuplicateUsername = errors.New("this username has already been registerd")
+	ErrorEditConflict      = errors.New("the post was edited at the same time, reload it and try again")
 	QueryTimeOutDuration   = time.Second * 5
 )
 
@@ -18,9 +22,26 @@ type Storage struct {
 	Posts interface {
 		GetById(context.Context, int64) (*Post, error)
 		Create(context.Context, *Post) error
-		Delete(context.Context, int64) error
+		Delete(ctx context.Context, postId int64, deletedBy int64) error
+		Restore(ctx context.Context, postId int64) error
+		GetDeletedById(ctx context.Context, id int64) (*Post, error)
+		GetTrash(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]Post, error)
+		PurgeDeleted(ctx context.Context, cutoff time.Time) (int64, []string, error)
 		Update(context.Context, *Post) error
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetDrafts(context.Context, int64, PaginatedFeedQuery) ([]Post, error)
+		PublishDue(context.Context, int) ([]Post, error)
+		NormalizeLegacyTags(context.Context, int) (int, error)
+		GetMentioning(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetByTag(ctx context.Context, tag string, viewerId int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetTimelineEntries(context.Context, []int64, PaginatedFeedQuery) ([]TimelineEntry, error)
+		GetFeedByIds(ctx context.Context, ids []int64, viewerId int64) ([]PostWithMetadata, error)
+		GetRankingCandidates(ctx context.Context, userId int64, fq PaginatedFeedQuery, since, until time.Time, limit int) ([]ranking.Candidate, error)
+		GetTopFollowed(ctx context.Context, userId int64, since time.Time, limit int) ([]int64, error)
+		GetProfileTimeline(ctx context.Context, authorId, viewerId int64, withReplies, mediaOnly bool, fq PaginatedFeedQuery) ([]ProfileEntry, error)
+		GetPinned(ctx context.Context, authorId, viewerId int64) ([]PostWithMetadata, error)
+		Pin(ctx context.Context, post *Post) error
+		Unpin(ctx context.Context, postId int64) error
 	}
 
 	Users interface {
@@ -30,27 +51,171 @@ type Storage struct {
 		Activate(context.Context, string) error
 		Delete(context.Context, int64) error
 		GetByEmail(context.Context, string) (*User, error)
+		GetProfile(ctx context.Context, userId int64, viewerId int64) (*Profile, error)
+		SetPrivate(ctx context.Context, userId int64, private bool) ([]int64, error)
+		SetDMFollowersOnly(ctx context.Context, userId int64, followersOnly bool) error
+		CanView(ctx context.Context, viewerId int64, authorId int64) (bool, error)
 	}
 	Comment interface {
 		Create(context.Context, *Comment) error
-		GetByPostId(context.Context, int64) ([]Comment, error)
+		GetById(context.Context, int64) (*Comment, error)
+		Update(context.Context, *Comment) error
+		Delete(context.Context, int64) error
+		GetByPostId(ctx context.Context, postId int64, viewerId int64) ([]Comment, error)
 	}
 	Followers interface {
-		Follow(ctx context.Context, followerId int64, userId int64) error
-		Unfollow(ctx context.Context, followerId int64, userId int64) error
+		Follow(ctx context.Context, followerId int64, userId int64) (bool, error)
+		Unfollow(ctx context.Context, followerId int64, userId int64) (bool, error)
+		GetRelationship(ctx context.Context, viewerId int64, userId int64) (*Relationship, error)
+		GetFollowerIds(context.Context, int64) ([]int64, error)
+		CountFollowers(context.Context, int64) (int64, error)
+		GetFollowedAbove(ctx context.Context, followerId int64, threshold int64) ([]int64, error)
+		GetFollowers(ctx context.Context, userId int64, viewerId int64, fq PaginatedFeedQuery) ([]FollowListEntry, error)
+		GetFollowing(ctx context.Context, userId int64, viewerId int64, fq PaginatedFeedQuery) ([]FollowListEntry, error)
+		GetSuggestions(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]Suggestion, error)
+	}
+	FollowRequests interface {
+		Create(ctx context.Context, requesterId int64, userId int64) error
+		Delete(ctx context.Context, requesterId int64, userId int64) (bool, error)
+		Approve(ctx context.Context, requesterId int64, userId int64) error
+		GetIncoming(context.Context, int64, PaginatedFeedQuery) ([]FollowRequest, error)
+		GetOutgoing(context.Context, int64, PaginatedFeedQuery) ([]FollowRequest, error)
+	}
+	Blocks interface {
+		Block(ctx context.Context, blockerId int64, blockedId int64) error
+		Unblock(ctx context.Context, blockerId int64, blockedId int64) error
+		Between(ctx context.Context, userId int64, otherId int64) (bool, error)
+		GetBlockedIds(context.Context, int64) ([]int64, error)
+		GetBlocked(context.Context, int64, PaginatedFeedQuery) ([]RelatedUser, error)
+	}
+	Mutes interface {
+		Mute(ctx context.Context, muterId int64, mutedId int64, expiresAt *time.Time) error
+		Unmute(ctx context.Context, muterId int64, mutedId int64) error
+		GetMuted(context.Context, int64, PaginatedFeedQuery) ([]RelatedUser, error)
+		PurgeExpired(context.Context) (int64, error)
 	}
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
 	}
+	Revisions interface {
+		GetByPostId(context.Context, int64) ([]PostRevision, error)
+		GetByVersion(context.Context, int64, int) (*PostRevision, error)
+	}
+	Attachments interface {
+		Create(ctx context.Context, postId int64, attachments []*Attachment, max int) error
+		GetById(context.Context, int64) (*Attachment, error)
+		GetByPostIds(context.Context, []int64) (map[int64][]Attachment, error)
+		CountByPostId(context.Context, int64) (int, error)
+		Delete(context.Context, int64) error
+	}
+	Mentions interface {
+		GetByPostIds(context.Context, []int64) (map[int64][]Mention, error)
+		GetByCommentIds(context.Context, []int64) (map[int64][]Mention, error)
+	}
+	Tags interface {
+		Trending(ctx context.Context, window time.Duration, limit int) ([]TrendingTag, error)
+	}
+	Reactions interface {
+		Set(ctx context.Context, postId int64, userId int64, kind string) (bool, error)
+		Remove(ctx context.Context, postId int64, userId int64) error
+		CountByPostIds(context.Context, []int64) (map[int64]map[string]int, error)
+	}
+	Search interface {
+		Posts(ctx context.Context, q string, viewerId int64, fq PaginatedFeedQuery) ([]PostSearchResult, error)
+		Comments(ctx context.Context, q string, viewerId int64, fq PaginatedFeedQuery) ([]CommentSearchResult, error)
+		Users(ctx context.Context, q string, viewerId int64, fq PaginatedFeedQuery) ([]UserSearchResult, error)
+	}
+	Notifications interface {
+		Record(context.Context, NewNotification) (int64, error)
+		Get(ctx context.Context, userId int64, unreadOnly bool, fq PaginatedFeedQuery) ([]Notification, error)
+		CountUnread(context.Context, int64) (map[string]int, error)
+		MarkRead(ctx context.Context, userId int64, id int64) error
+		MarkAllRead(context.Context, int64) (int64, error)
+		GetForDigest(ctx context.Context, userId int64, mode string, limit int) ([]Notification, error)
+		MarkEmailed(ctx context.Context, userId int64, ids []int64) error
+		ClaimEmails(ctx context.Context, limit int, throttle time.Duration) ([]NotificationEmail, error)
+		GetById(ctx context.Context, userId int64, id int64) (*Notification, error)
+	}
+	EmailPreferences interface {
+		Get(context.Context, int64) (map[string]string, error)
+		Set(ctx context.Context, userId int64, prefs map[string]string) error
+		ClaimDigestRecipients(ctx context.Context, frequency string, interval time.Duration, limit int) ([]DigestRecipient, error)
+		ReleaseDigest(ctx context.Context, r DigestRecipient, frequency string) error
+	}
+	Stream interface {
+		Publish(context.Context, *stream.Event) error
+		Notify(context.Context, stream.Event) error
+		GetById(context.Context, int64) (stream.Event, error)
+		GetSince(ctx context.Context, topics []string, afterId int64, limit int) ([]stream.Event, error)
+		GetAuthorIds(context.Context, int64) ([]int64, error)
+		Purge(context.Context, time.Time) (int64, error)
+	}
+	Webhooks interface {
+		Create(context.Context, *Webhook) error
+		GetById(context.Context, int64) (*Webhook, error)
+		GetByUser(context.Context, int64) ([]Webhook, error)
+		Update(context.Context, *Webhook) error
+		Delete(context.Context, int64) error
+		Enqueue(ctx context.Context, eventType string, userIds []int64, payload []byte) (int64, error)
+		ClaimDue(ctx context.Context, limit int, lease time.Time) ([]DueDelivery, error)
+		RecordAttempt(ctx context.Context, d DueDelivery, attempt WebhookAttempt, next *time.Time, disableAfter int) (bool, error)
+		GetDeliveries(ctx context.Context, webhookId int64, fq PaginatedFeedQuery) ([]WebhookDelivery, error)
+		GetDelivery(ctx context.Context, webhookId, id int64) (*WebhookDelivery, error)
+		Redeliver(ctx context.Context, webhookId, id int64) (*WebhookDelivery, error)
+		PurgeDeliveries(context.Context, time.Time) (int64, error)
+	}
+	Conversations interface {
+		Create(ctx context.Context, creatorId int64, memberIds []int64) (int64, bool, error)
+		GetUnreachable(ctx context.Context, senderId int64, recipientIds []int64) ([]int64, error)
+		GetById(ctx context.Context, id int64, userId int64) (*Conversation, error)
+		GetByUser(context.Context, int64, PaginatedFeedQuery) ([]Conversation, error)
+		GetMessages(ctx context.Context, conversationId int64, viewerId int64, fq PaginatedFeedQuery) ([]Message, error)
+		CreateMessage(context.Context, *Message) error
+		MarkRead(ctx context.Context, conversationId int64, userId int64, upTo int64) (int64, error)
+	}
+	Bookmarks interface {
+		Set(ctx context.Context, userId, postId int64, collectionId *int64, move bool) error
+		Remove(ctx context.Context, userId, postId int64) error
+		Get(ctx context.Context, userId int64, collectionId *int64, fq PaginatedFeedQuery) ([]Bookmark, error)
+		GetCollections(context.Context, int64) ([]BookmarkCollection, error)
+		GetCollection(ctx context.Context, userId, id int64) (*BookmarkCollection, error)
+		CreateCollection(context.Context, *BookmarkCollection) error
+		RenameCollection(context.Context, *BookmarkCollection) error
+		DeleteCollection(ctx context.Context, userId, id int64) error
+	}
+	Timelines interface {
+		Push(ctx context.Context, userIds []int64, entries []TimelineEntry) error
+		RemoveAuthor(ctx context.Context, userId int64, authorId int64) error
+		Get(context.Context, int64, PaginatedFeedQuery) ([]TimelineEntry, error)
+		EnqueueJob(ctx context.Context, job *TimelineJob) error
+		ClaimJobs(ctx context.Context, limit int, lease time.Time) ([]TimelineJob, error)
+		CompleteJob(ctx context.Context, id int64) error
+	}
 }
 
 func NewPostgresStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostgresPostsStore{db},
-		Users:     &PostgresUsersStore{db},
-		Comment:   &PostgresCommentsStore{db},
-		Followers: &FollowerRepository{db},
-		Roles:     &RoleRepo{db},
+		Posts:            &PostgresPostsStore{db},
+		Users:            &PostgresUsersStore{db},
+		Comment:          &PostgresCommentsStore{db},
+		Followers:        &FollowerRepository{db},
+		FollowRequests:   &PostgresFollowRequestsStore{db},
+		Blocks:           &PostgresBlocksStore{db},
+		Mutes:            &PostgresMutesStore{db},
+		Roles:            &RoleRepo{db},
+		Revisions:        &PostgresRevisionsStore{db},
+		Attachments:      &PostgresAttachmentsStore{db},
+		Mentions:         &PostgresMentionsStore{db},
+		Tags:             &PostgresTagsStore{db},
+		Timelines:        &PostgresTimelinesStore{db},
+		Reactions:        &PostgresReactionsStore{db},
+		Search:           &PostgresSearchStore{db},
+		Notifications:    &PostgresNotificationsStore{db},
+		EmailPreferences: &PostgresEmailPreferencesStore{db},
+		Stream:           &PostgresStreamStore{db},
+		Webhooks:         &PostgresWebhooksStore{db},
+		Conversations:    &PostgresConversationsStore{db},
+		Bookmarks:        &PostgresBookmarksStore{db},
 	}
 }
 func withTx(db *sql.DB, ctx context.Context, fn func(*sql.Tx) error) error {
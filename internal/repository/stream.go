@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/carlosEA28/Social/internal/stream"
+	"github.com/lib/pq"
+)
+
+type PostgresStreamStore struct {
+	db *sql.DB
+}
+
+// streamEventsLock is the advisory lock stream events are inserted under.
+const streamEventsLock = 7310244
+
+// Publish stores e, whose insert trigger notifies every listening instance, and
+// fills in its id and creation time. Clients resume after the last id they saw,
+// so inserts take turns under an advisory lock held until they commit: ids are
+// then committed in order and an event with a lower id can't show up after a
+// client already saw a higher one.
+func (s *PostgresStreamStore) Publish(ctx context.Context, e *stream.Event) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, streamEventsLock); err != nil {
+			return err
+		}
+
+		query := `
+		INSERT INTO stream_events (topic, type, actor_id, data)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+		`
+
+		return tx.QueryRowContext(ctx, query, e.Topic, e.Type, e.ActorID, []byte(e.Data)).Scan(&e.ID, &e.CreatedAt)
+	})
+}
+
+// Notify sends e to every listening instance without storing it, for events
+// that are stale by the time a client could resume, such as typing indicators.
+func (s *PostgresStreamStore) Notify(ctx context.Context, e stream.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err = s.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, stream.Channel, string(payload))
+	return err
+}
+
+func (s *PostgresStreamStore) GetById(ctx context.Context, id int64) (stream.Event, error) {
+	query := `SELECT id, topic, type, actor_id, data, created_at FROM stream_events WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var e stream.Event
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&e.ID, &e.Topic, &e.Type, &e.ActorID, &e.Data, &e.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return e, ErrorNotFound
+		default:
+			return e, err
+		}
+	}
+
+	return e, nil
+}
+
+// GetSince lists up to limit of the events of topics that came after afterId, oldest first.
+func (s *PostgresStreamStore) GetSince(ctx context.Context, topics []string, afterId int64, limit int) ([]stream.Event, error) {
+	query := `
+	SELECT id, topic, type, actor_id, data, created_at
+	FROM stream_events
+	WHERE topic = ANY($1) AND id > $2
+	ORDER BY id
+	LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(topics), afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []stream.Event
+	for rows.Next() {
+		var e stream.Event
+		if err := rows.Scan(&e.ID, &e.Topic, &e.Type, &e.ActorID, &e.Data, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// GetAuthorIds lists the authors whose new posts show up in the stream of
+// userId: themselves and the accounts they follow and haven't muted.
+func (s *PostgresStreamStore) GetAuthorIds(ctx context.Context, userId int64) ([]int64, error) {
+	query := `
+	SELECT $1::bigint
+	UNION
+	SELECT f.user_id FROM followers f WHERE f.follower_id = $1 AND ` + notMuted("f.user_id", "$1") + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Purge deletes the events created before cutoff, clients can no longer resume from them.
+func (s *PostgresStreamStore) Purge(ctx context.Context, cutoff time.Time) (int64, error) {
+	query := `DELETE FROM stream_events WHERE created_at < $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type TrendingTag struct {
+	Tag           string  `json:"tag"`
+	Posts         int     `json:"posts"`
+	Authors       int     `json:"authors"`
+	PreviousPosts int     `json:"previous_posts"`
+	Score         float64 `json:"score"`
+}
+
+type PostgresTagsStore struct {
+	db *sql.DB
+}
+
+// Trending ranks the tags used in the last window against the window before it.
+// The score rewards tags picked up by many different authors and growing faster
+// than they were, so a single account spamming a tag or an evergreen tag with
+// steady volume don't dominate.
+func (s *PostgresTagsStore) Trending(ctx context.Context, window time.Duration, limit int) ([]TrendingTag, error) {
+	query := `
+	WITH usage AS (
+		SELECT t.tag, p.user_id, p.created_at >= NOW() - $1::interval AS current
+		FROM posts p, unnest(p.tags) AS t(tag)
+		WHERE p.status = 'published' AND p.deleted_at IS NULL
+		AND p.created_at >= NOW() - 2 * $1::interval
+	), counts AS (
+		SELECT
+			tag,
+			COUNT(*) FILTER (WHERE current) AS posts,
+			COUNT(DISTINCT user_id) FILTER (WHERE current) AS authors,
+			COUNT(*) FILTER (WHERE NOT current) AS previous_posts
+		FROM usage
+		GROUP BY tag
+	)
+	SELECT tag, posts, authors, previous_posts,
+		authors * (posts + 1.0) / (previous_posts + 1.0) AS score
+	FROM counts
+	WHERE posts > 0
+	ORDER BY score DESC, posts DESC, tag
+	LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	interval := fmt.Sprintf("%d seconds", int64(window.Seconds()))
+
+	rows, err := s.db.QueryContext(ctx, query, interval, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TrendingTag{}
+	for rows.Next() {
+		var t TrendingTag
+		if err := rows.Scan(&t.Tag, &t.Posts, &t.Authors, &t.PreviousPosts, &t.Score); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TimelineEntry is a post pushed into a materialized home timeline.
+type TimelineEntry struct {
+	PostID    int64
+	AuthorID  int64
+	CreatedAt time.Time
+}
+
+// Before reports whether e sorts before other in a newest first timeline.
+func (e TimelineEntry) Before(other TimelineEntry) bool {
+	if !e.CreatedAt.Equal(other.CreatedAt) {
+		return e.CreatedAt.After(other.CreatedAt)
+	}
+
+	return e.PostID > other.PostID
+}
+
+// PostgresTimelinesStore is the durable copy of the materialized timelines, the
+// Redis one in the cache package only holds the newest entries of active users.
+type PostgresTimelinesStore struct {
+	db *sql.DB
+}
+
+// Push adds every entry to the timeline of every user in userIds.
+func (s *PostgresTimelinesStore) Push(ctx context.Context, userIds []int64, entries []TimelineEntry) error {
+	if len(userIds) == 0 || len(entries) == 0 {
+		return nil
+	}
+
+	postIds := make([]int64, len(entries))
+	authorIds := make([]int64, len(entries))
+	createdAts := make([]string, len(entries))
+	for i, e := range entries {
+		postIds[i] = e.PostID
+		authorIds[i] = e.AuthorID
+		createdAts[i] = e.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	query := `
+	INSERT INTO timelines (user_id, post_id, author_id, created_at)
+	SELECT u.id, e.post_id, e.author_id, e.created_at
+	FROM unnest($1::bigint[]) AS u(id)
+	CROSS JOIN unnest($2::bigint[], $3::bigint[], $4::timestamptz[]) AS e(post_id, author_id, created_at)
+	ON CONFLICT (user_id, post_id) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, pq.Array(userIds), pq.Array(postIds), pq.Array(authorIds), pq.Array(createdAts))
+	return err
+}
+
+// RemoveAuthor drops the posts of authorId from the timeline of userId.
+func (s *PostgresTimelinesStore) RemoveAuthor(ctx context.Context, userId int64, authorId int64) error {
+	query := `DELETE FROM timelines WHERE user_id = $1 AND author_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userId, authorId)
+	return err
+}
+
+// Get returns a page of the timeline of userId, newest first. Only the limit and
+// cursor of fq are honored, filtered or ascending listings go through GetUserFeed.
+func (s *PostgresTimelinesStore) Get(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]TimelineEntry, error) {
+	fq.Sort = "desc"
+	keyset, args := fq.keyset("created_at", "post_id", 3)
+
+	query := `
+	SELECT post_id, author_id, created_at
+	FROM timelines
+	WHERE user_id = $1 AND ` + keyset + `
+	ORDER BY created_at DESC, post_id DESC
+	LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{userId, fq.Limit}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []TimelineEntry{}
+	for rows.Next() {
+		var e TimelineEntry
+		if err := rows.Scan(&e.PostID, &e.AuthorID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// Kinds of timeline jobs.
+const (
+	TimelineJobFanOut   = "fan_out"
+	TimelineJobBackfill = "backfill"
+	TimelineJobRemove   = "remove"
+)
+
+// TimelineJob is fan-out work kept in Postgres until a worker has done it, so
+// that neither a burst of posts nor a restart loses timeline writes. PostID is
+// set for fan-outs and FollowerID for backfills and removals.
+type TimelineJob struct {
+	ID         int64
+	Kind       string
+	AuthorID   int64
+	PostID     int64
+	FollowerID int64
+	Attempts   int
+}
+
+// EnqueueJob saves job to be run by the next worker that claims it.
+func (s *PostgresTimelinesStore) EnqueueJob(ctx context.Context, job *TimelineJob) error {
+	query := `
+	INSERT INTO timeline_jobs (kind, author_id, post_id, follower_id)
+	VALUES ($1, $2, NULLIF($3::bigint, 0), NULLIF($4::bigint, 0))
+	RETURNING id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, job.Kind, job.AuthorID, job.PostID, job.FollowerID).Scan(&job.ID)
+}
+
+// ClaimJobs picks up to limit due jobs, oldest first, and pushes them back to
+// lease so that no other worker runs them meanwhile. A job that isn't completed
+// before the lease is over is claimed again.
+func (s *PostgresTimelinesStore) ClaimJobs(ctx context.Context, limit int, lease time.Time) ([]TimelineJob, error) {
+	query := `
+	UPDATE timeline_jobs SET run_at = $2, attempts = attempts + 1
+	WHERE id IN (
+		SELECT id FROM timeline_jobs
+		WHERE run_at <= NOW()
+		ORDER BY run_at, id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, kind, author_id, COALESCE(post_id, 0), COALESCE(follower_id, 0), attempts
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []TimelineJob
+	for rows.Next() {
+		var job TimelineJob
+		if err := rows.Scan(&job.ID, &job.Kind, &job.AuthorID, &job.PostID, &job.FollowerID, &job.Attempts); err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// CompleteJob removes a job that was run.
+func (s *PostgresTimelinesStore) CompleteJob(ctx context.Context, id int64) error {
+	query := `DELETE FROM timeline_jobs WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
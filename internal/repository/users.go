@@ -19,6 +19,7 @@ type User struct {
 	CreatedAt string   `json:"created_at"`
 	UpdatedAt string   `json:"updated_at"`
 	IsActive  bool     `json:"is_active"`
+	IsPrivate bool     `json:"is_private"`
 	RoleId    int64    `json:"role_id"`
 	Role      Role     `json:"role"`
 }
@@ -74,7 +75,7 @@ func (s *PostgresUsersStore) Create(ctx context.Context, tx *sql.Tx, user *User)
 
 func (s *PostgresUsersStore) GetUserById(ctx context.Context, userID int64) (*User, error) {
 	query := `
-		SELECT users.id, username, email, password, created_at, roles.*
+		SELECT users.id, username, email, password, created_at, is_private, roles.*
 		FROM users
 		JOIN roles ON (users.role_id = roles.id)
 		WHERE users.id = $1 AND is_active = true
@@ -94,6 +95,7 @@ func (s *PostgresUsersStore) GetUserById(ctx context.Context, userID int64) (*Us
 		&user.Email,
 		&user.Password.hash,
 		&user.CreatedAt,
+		&user.IsPrivate,
 		&user.Role.Id,
 		&user.Role.Name,
 		&user.Role.Level,
@@ -277,3 +279,115 @@ func (s *PostgresUsersStore) GetByEmail(ctx context.Context, email string) (*Use
 
 	return user, nil
 }
+
+// Profile is the public view of a user as seen by viewer.
+type Profile struct {
+	ID               int64  `json:"id"`
+	Username         string `json:"username"`
+	CreatedAt        string `json:"created_at"`
+	IsPrivate        bool   `json:"is_private"`
+	FollowersCount   int64  `json:"followers_count"`
+	FollowingCount   int64  `json:"following_count"`
+	FollowedByViewer bool   `json:"followed_by_viewer"`
+	FollowsViewer    bool   `json:"follows_viewer"`
+	// DMFollowersOnly limits who can message the user to the accounts they follow.
+	DMFollowersOnly bool `json:"dm_followers_only"`
+}
+
+func (s *PostgresUsersStore) GetProfile(ctx context.Context, userId int64, viewerId int64) (*Profile, error) {
+	query := `
+	SELECT u.id, u.username, u.created_at, u.is_private, u.followers_count, u.following_count,
+	EXISTS (SELECT 1 FROM followers f WHERE f.user_id = u.id AND f.follower_id = $2),
+	EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $2 AND f.follower_id = u.id),
+	u.dm_followers_only
+	FROM users u
+	WHERE u.id = $1 AND u.is_active = true
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var profile Profile
+	err := s.db.QueryRowContext(ctx, query, userId, viewerId).Scan(
+		&profile.ID,
+		&profile.Username,
+		&profile.CreatedAt,
+		&profile.IsPrivate,
+		&profile.FollowersCount,
+		&profile.FollowingCount,
+		&profile.FollowedByViewer,
+		&profile.FollowsViewer,
+		&profile.DMFollowersOnly,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &profile, nil
+}
+
+// SetDMFollowersOnly changes whether only the accounts userId follows can start
+// conversations with them.
+func (s *PostgresUsersStore) SetDMFollowersOnly(ctx context.Context, userId int64, followersOnly bool) error {
+	query := `UPDATE users SET dm_followers_only = $2 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userId, followersOnly)
+	return err
+}
+
+// SetPrivate changes whether userId is a private account. Making an account
+// public approves its pending follow requests, the ids of the accounts that were
+// waiting are returned.
+func (s *PostgresUsersStore) SetPrivate(ctx context.Context, userId int64, private bool) ([]int64, error) {
+	var approved []int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET is_private = $2 WHERE id = $1`, userId, private); err != nil {
+			return err
+		}
+
+		if private {
+			return nil
+		}
+
+		query := `
+		WITH approved AS (
+			DELETE FROM follow_requests WHERE user_id = $1 RETURNING requester_id
+		)
+		INSERT INTO followers (user_id, follower_id)
+		SELECT $1, requester_id FROM approved
+		ON CONFLICT (user_id, follower_id) DO NOTHING
+		RETURNING follower_id
+		`
+
+		rows, err := tx.QueryContext(ctx, query, userId)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+
+			approved = append(approved, id)
+		}
+
+		return rows.Err()
+	})
+
+	return approved, err
+}
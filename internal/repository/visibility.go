@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// visibleAuthor returns the condition for content written by the user in
+// authorColumn to be visible to the user bound to viewerArg. Blocks hide both
+// sides from each other and private accounts are only seen by themselves and
+// their approved followers, pending follow requests don't count.
+func visibleAuthor(authorColumn, viewerArg string) string {
+	return fmt.Sprintf(`(%[3]s AND (%[1]s = %[2]s
+	OR NOT EXISTS (SELECT 1 FROM users vu WHERE vu.id = %[1]s AND vu.is_private)
+	OR EXISTS (SELECT 1 FROM followers vf WHERE vf.user_id = %[1]s AND vf.follower_id = %[2]s)))`, authorColumn, viewerArg, notBlocked(authorColumn, viewerArg))
+}
+
+// notBlocked returns the condition for neither of the users in userColumn and
+// otherArg to have blocked the other.
+func notBlocked(userColumn, otherArg string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM blocks vb
+	WHERE (vb.blocker_id = %[1]s AND vb.blocked_id = %[2]s) OR (vb.blocker_id = %[2]s AND vb.blocked_id = %[1]s))`, userColumn, otherArg)
+}
+
+// notMuted returns the condition for the user in authorColumn not to be muted by
+// the user bound to viewerArg. Mutes only apply to the muter's feeds.
+func notMuted(authorColumn, viewerArg string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM mutes vm
+	WHERE vm.muter_id = %[2]s AND vm.muted_id = %[1]s AND (vm.expires_at IS NULL OR vm.expires_at > NOW()))`, authorColumn, viewerArg)
+}
+
+// CanView reports whether viewerId may see the content of authorId.
+func (s *PostgresUsersStore) CanView(ctx context.Context, viewerId int64, authorId int64) (bool, error) {
+	query := `SELECT ` + visibleAuthor("$2::bigint", "$1::bigint")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var visible bool
+	err := s.db.QueryRowContext(ctx, query, viewerId, authorId).Scan(&visible)
+	return visible, err
+}
@@ -0,0 +1,530 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+type Webhook struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"user_id"`
+	URL    string `json:"url"`
+	// Secret signs the deliveries, it is only shown when the webhook is created.
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events"`
+	// Global webhooks get every event of their types, the others only those
+	// concerning their owner.
+	Global bool `json:"global"`
+	Active bool `json:"active"`
+	// FailureCount counts the failed attempts since the last successful one.
+	FailureCount int        `json:"failure_count"`
+	DisabledAt   *time.Time `json:"disabled_at"`
+	CreatedAt    string     `json:"created_at"`
+	UpdatedAt    string     `json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64            `json:"id"`
+	WebhookID      int64            `json:"webhook_id"`
+	EventType      string           `json:"event_type"`
+	Payload        json.RawMessage  `json:"payload"`
+	Status         string           `json:"status"`
+	AttemptCount   int              `json:"attempt_count"`
+	NextAttemptAt  *time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int             `json:"last_status_code"`
+	LastError      *string          `json:"last_error"`
+	CreatedAt      string           `json:"created_at"`
+	DeliveredAt    *time.Time       `json:"delivered_at"`
+	Attempts       []WebhookAttempt `json:"attempts,omitempty"`
+}
+
+type WebhookAttempt struct {
+	StatusCode  *int      `json:"status_code"`
+	Error       *string   `json:"error"`
+	Duration    int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// DueDelivery is a delivery claimed for an attempt along with where it goes.
+type DueDelivery struct {
+	ID           int64
+	WebhookID    int64
+	EventType    string
+	Payload      []byte
+	AttemptCount int
+	URL          string
+	Secret       string
+}
+
+type PostgresWebhooksStore struct {
+	db *sql.DB
+}
+
+func (s *PostgresWebhooksStore) Create(ctx context.Context, webhook *Webhook) error {
+	query := `
+	INSERT INTO webhooks (user_id, url, secret, events, global)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, active, created_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		webhook.UserID,
+		webhook.URL,
+		webhook.Secret,
+		pq.Array(webhook.Events),
+		webhook.Global,
+	).Scan(&webhook.ID, &webhook.Active, &webhook.CreatedAt, &webhook.UpdatedAt)
+}
+
+// GetById returns webhook id without its secret.
+func (s *PostgresWebhooksStore) GetById(ctx context.Context, id int64) (*Webhook, error) {
+	query := `
+	SELECT id, user_id, url, events, global, active, failure_count, disabled_at, created_at, updated_at
+	FROM webhooks
+	WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks, err := scanWebhooks(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(webhooks) == 0 {
+		return nil, ErrorNotFound
+	}
+
+	return &webhooks[0], nil
+}
+
+// GetByUser lists the webhooks of userId, oldest first and without their secrets.
+func (s *PostgresWebhooksStore) GetByUser(ctx context.Context, userId int64) ([]Webhook, error) {
+	query := `
+	SELECT id, user_id, url, events, global, active, failure_count, disabled_at, created_at, updated_at
+	FROM webhooks
+	WHERE user_id = $1
+	ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanWebhooks(rows)
+}
+
+func scanWebhooks(rows *sql.Rows) ([]Webhook, error) {
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var w Webhook
+		err := rows.Scan(
+			&w.ID,
+			&w.UserID,
+			&w.URL,
+			pq.Array(&w.Events),
+			&w.Global,
+			&w.Active,
+			&w.FailureCount,
+			&w.DisabledAt,
+			&w.CreatedAt,
+			&w.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, w)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// Update saves the url, events and active flag of webhook. Turning it back on
+// clears its failures, its pending deliveries are then retried right away.
+func (s *PostgresWebhooksStore) Update(ctx context.Context, webhook *Webhook) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		query := `
+		UPDATE webhooks SET
+		url = $1, events = $2, updated_at = NOW(),
+		failure_count = CASE WHEN $3 AND NOT active THEN 0 ELSE failure_count END,
+		disabled_at = CASE WHEN $3 THEN NULL ELSE COALESCE(disabled_at, NOW()) END,
+		active = $3
+		WHERE id = $4
+		RETURNING failure_count, disabled_at, updated_at
+		`
+
+		err := tx.QueryRowContext(ctx, query, webhook.URL, pq.Array(webhook.Events), webhook.Active, webhook.ID).Scan(
+			&webhook.FailureCount,
+			&webhook.DisabledAt,
+			&webhook.UpdatedAt,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+
+		if !webhook.Active {
+			return nil
+		}
+
+		query = `
+		UPDATE webhook_deliveries SET next_attempt_at = NOW()
+		WHERE webhook_id = $1 AND status = 'pending' AND next_attempt_at > NOW()
+		`
+
+		_, err = tx.ExecContext(ctx, query, webhook.ID)
+		return err
+	})
+}
+
+func (s *PostgresWebhooksStore) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM webhooks WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+// Enqueue queues a delivery of payload to every active webhook subscribed to
+// eventType that is either global or owned by one of userIds, and returns how
+// many were queued.
+func (s *PostgresWebhooksStore) Enqueue(ctx context.Context, eventType string, userIds []int64, payload []byte) (int64, error) {
+	query := `
+	INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+	SELECT id, $1::varchar, $3::jsonb
+	FROM webhooks
+	WHERE active AND events @> ARRAY[$1::varchar(50)] AND (global OR user_id = ANY($2))
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, eventType, pq.Array(userIds), string(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// ClaimDue picks up to limit pending deliveries of active webhooks whose next
+// attempt is due and pushes that attempt back to lease, so that no other
+// instance attempts them meanwhile. A delivery whose attempt is never recorded
+// is retried once the lease is over.
+func (s *PostgresWebhooksStore) ClaimDue(ctx context.Context, limit int, lease time.Time) ([]DueDelivery, error) {
+	query := `
+	WITH due AS (
+		SELECT d.id
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND w.active
+		ORDER BY d.next_attempt_at
+		LIMIT $1
+		FOR UPDATE OF d SKIP LOCKED
+	)
+	UPDATE webhook_deliveries d SET next_attempt_at = $2
+	FROM due, webhooks w
+	WHERE d.id = due.id AND w.id = d.webhook_id
+	RETURNING d.id, d.webhook_id, d.event_type, d.payload, d.attempts, w.url, w.secret
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []DueDelivery
+	for rows.Next() {
+		var d DueDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.AttemptCount, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RecordAttempt saves the outcome of an attempt at delivery id. A failed attempt
+// is retried at next, or fails the delivery for good when next is nil, and the
+// webhook is disabled once it has failed disableAfter times in a row. It reports
+// whether the webhook was disabled.
+func (s *PostgresWebhooksStore) RecordAttempt(ctx context.Context, d DueDelivery, attempt WebhookAttempt, next *time.Time, disableAfter int) (bool, error) {
+	var disabled bool
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		query := `
+		INSERT INTO webhook_attempts (delivery_id, status_code, error, duration_ms, attempted_at)
+		VALUES ($1, $2, $3, $4, $5)
+		`
+
+		_, err := tx.ExecContext(ctx, query, d.ID, attempt.StatusCode, attempt.Error, attempt.Duration, attempt.AttemptedAt)
+		if err != nil {
+			return err
+		}
+
+		succeeded := attempt.Error == nil
+
+		status := DeliveryPending
+		switch {
+		case succeeded:
+			status, next = DeliverySucceeded, nil
+		case next == nil:
+			status = DeliveryFailed
+		}
+
+		query = `
+		UPDATE webhook_deliveries SET
+		status = $1, attempts = attempts + 1, next_attempt_at = $2, last_status_code = $3, last_error = $4,
+		delivered_at = CASE WHEN $5 THEN $6::timestamptz END
+		WHERE id = $7
+		`
+
+		_, err = tx.ExecContext(ctx, query, status, next, attempt.StatusCode, attempt.Error, succeeded, attempt.AttemptedAt, d.ID)
+		if err != nil {
+			return err
+		}
+
+		if succeeded {
+			query = `UPDATE webhooks SET failure_count = 0 WHERE id = $1 AND failure_count > 0`
+			_, err = tx.ExecContext(ctx, query, d.WebhookID)
+			return err
+		}
+
+		var wasActive bool
+		err = tx.QueryRowContext(ctx, `SELECT active FROM webhooks WHERE id = $1 FOR UPDATE`, d.WebhookID).Scan(&wasActive)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return nil
+			default:
+				return err
+			}
+		}
+
+		query = `
+		UPDATE webhooks SET
+		failure_count = failure_count + 1,
+		active = active AND failure_count + 1 < $2,
+		disabled_at = CASE WHEN active AND failure_count + 1 >= $2 THEN NOW() ELSE disabled_at END
+		WHERE id = $1
+		RETURNING active
+		`
+
+		var active bool
+		if err := tx.QueryRowContext(ctx, query, d.WebhookID, disableAfter).Scan(&active); err != nil {
+			return err
+		}
+
+		disabled = wasActive && !active
+		return nil
+	})
+
+	return disabled, err
+}
+
+// GetDeliveries lists the deliveries of webhookId, newest first, without their attempts.
+func (s *PostgresWebhooksStore) GetDeliveries(ctx context.Context, webhookId int64, fq PaginatedFeedQuery) ([]WebhookDelivery, error) {
+	keyset, args := fq.keyset("created_at", "id", 4)
+
+	query := `
+	SELECT id, webhook_id, event_type, payload, status, attempts, next_attempt_at,
+	last_status_code, last_error, created_at, delivered_at
+	FROM webhook_deliveries
+	WHERE webhook_id = $1 AND ` + keyset + `
+	ORDER BY created_at ` + fq.Sort + `, id ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{webhookId, fq.Limit, fq.Offset}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// GetDelivery returns delivery id of webhookId along with its attempts, oldest first.
+func (s *PostgresWebhooksStore) GetDelivery(ctx context.Context, webhookId, id int64) (*WebhookDelivery, error) {
+	query := `
+	SELECT id, webhook_id, event_type, payload, status, attempts, next_attempt_at,
+	last_status_code, last_error, created_at, delivered_at
+	FROM webhook_deliveries
+	WHERE id = $1 AND webhook_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	d, err := scanDelivery(s.db.QueryRowContext(ctx, query, id, webhookId))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+	SELECT status_code, error, duration_ms, attempted_at
+	FROM webhook_attempts
+	WHERE delivery_id = $1
+	ORDER BY id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	d.Attempts = []WebhookAttempt{}
+	for rows.Next() {
+		var a WebhookAttempt
+		if err := rows.Scan(&a.StatusCode, &a.Error, &a.Duration, &a.AttemptedAt); err != nil {
+			return nil, err
+		}
+
+		d.Attempts = append(d.Attempts, a)
+	}
+
+	return &d, rows.Err()
+}
+
+// Redeliver queues a new delivery of the payload of delivery id of webhookId,
+// the original one keeps its history.
+func (s *PostgresWebhooksStore) Redeliver(ctx context.Context, webhookId, id int64) (*WebhookDelivery, error) {
+	query := `
+	INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+	SELECT webhook_id, event_type, payload
+	FROM webhook_deliveries
+	WHERE id = $1 AND webhook_id = $2
+	RETURNING id, webhook_id, event_type, payload, status, attempts, next_attempt_at,
+	last_status_code, last_error, created_at, delivered_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	d, err := scanDelivery(s.db.QueryRowContext(ctx, query, id, webhookId))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &d, nil
+}
+
+// PurgeDeliveries deletes the deliveries created before cutoff that are no
+// longer pending, along with their attempts.
+func (s *PostgresWebhooksStore) PurgeDeliveries(ctx context.Context, cutoff time.Time) (int64, error) {
+	query := `DELETE FROM webhook_deliveries WHERE created_at < $1 AND status <> 'pending'`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func scanDelivery(row interface{ Scan(...any) error }) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	err := row.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.EventType,
+		&d.Payload,
+		&d.Status,
+		&d.AttemptCount,
+		&d.NextAttemptAt,
+		&d.LastStatusCode,
+		&d.LastError,
+		&d.CreatedAt,
+		&d.DeliveredAt,
+	)
+
+	return d, err
+}
@@ -0,0 +1,80 @@
+package signer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type cursor struct {
+	At int64  `json:"at"`
+	ID int64  `json:"id"`
+	To string `json:"to,omitempty"`
+}
+
+func TestSignVerify(t *testing.T) {
+	s := New("secret", "cursor")
+
+	token, err := s.Sign(cursor{At: 1700000000, ID: 42, To: "/v1/feed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got cursor
+	if err := s.Verify(token, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (cursor{At: 1700000000, ID: 42, To: "/v1/feed"}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if strings.ContainsAny(token, "+/=") {
+		t.Errorf("token %q isn't url safe", token)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	s := New("secret", "cursor")
+
+	token, err := s.Sign(cursor{At: 1700000000, ID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, signature, _ := strings.Cut(token, ".")
+
+	forged, err := s.Sign(cursor{At: 1700000000, ID: 43})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	notACursor, err := s.Sign([]int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		signer *Signer
+		token  string
+	}{
+		{"another purpose", New("secret", "unsubscribe"), token},
+		{"another secret", New("other", "cursor"), token},
+		{"a payload from another token", s, forgedPayload + "." + signature},
+		{"a changed signature", s, payload + "." + strings.Repeat("A", len(signature))},
+		{"no signature", s, payload},
+		{"an empty token", s, ""},
+		{"garbage", s, "not.a-token"},
+		{"a value of another type", s, notACursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c cursor
+			if err := tt.signer.Verify(tt.token, &c); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("got %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}
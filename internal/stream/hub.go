@@ -0,0 +1,119 @@
+// Package stream delivers events to the clients connected to this instance as
+// they happen, whichever instance they happened on.
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Event is a message for the subscribers of Topic. IDs grow with every event
+// across all topics and instances, clients resume from the last one they saw.
+// Events that aren't kept for resuming have no ID.
+type Event struct {
+	ID        int64           `json:"id"`
+	Topic     string          `json:"topic"`
+	Type      string          `json:"type"`
+	ActorID   int64           `json:"actor_id"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// UserTopic carries the events addressed to a single user, such as their notifications.
+func UserTopic(userId int64) string {
+	return fmt.Sprintf("user:%d", userId)
+}
+
+// AuthorTopic carries the posts published by an author.
+func AuthorTopic(userId int64) string {
+	return fmt.Sprintf("author:%d", userId)
+}
+
+// PostTopic carries what happens under a post, such as new comments.
+func PostTopic(postId int64) string {
+	return fmt.Sprintf("post:%d", postId)
+}
+
+// Hub fans events out to the local subscribers of their topic.
+type Hub struct {
+	mu     sync.RWMutex
+	topics map[string]map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{topics: make(map[string]map[*Subscription]struct{})}
+}
+
+// Subscription receives the events of its topics on C until it is closed. A
+// subscriber that lets buffer events pile up is dropped and Done is closed, it
+// is expected to resume from the last event it handled.
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	done   chan struct{}
+	once   sync.Once
+	hub    *Hub
+	topics []string
+}
+
+func (h *Hub) Subscribe(topics []string, buffer int) *Subscription {
+	c := make(chan Event, buffer)
+	s := &Subscription{C: c, c: c, done: make(chan struct{}), hub: h, topics: topics}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, topic := range topics {
+		subs, ok := h.topics[topic]
+		if !ok {
+			subs = make(map[*Subscription]struct{})
+			h.topics[topic] = subs
+		}
+		subs[s] = struct{}{}
+	}
+
+	return s
+}
+
+// Done is closed once the subscription stops receiving events.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		defer s.hub.mu.Unlock()
+
+		for _, topic := range s.topics {
+			delete(s.hub.topics[topic], s)
+			if len(s.hub.topics[topic]) == 0 {
+				delete(s.hub.topics, topic)
+			}
+		}
+
+		close(s.done)
+	})
+}
+
+// Deliver hands e to the subscribers of its topic without waiting on any of them.
+func (h *Hub) Deliver(e Event) {
+	var slow []*Subscription
+
+	h.mu.RLock()
+	for s := range h.topics[e.Topic] {
+		select {
+		case s.c <- e:
+		default:
+			slow = append(slow, s)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, s := range slow {
+		s.Close()
+	}
+}
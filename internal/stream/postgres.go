@@ -0,0 +1,65 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Channel is the Postgres notification channel the stream_events trigger notifies on.
+const Channel = "stream_events"
+
+const listenerPingInterval = time.Minute
+
+// Listen delivers to hub the events notified on Channel by every instance until
+// ctx is cancelled. Notifications too large to carry their event only carry its
+// id, load reads those back. Events notified while the connection is down are
+// missed, clients recover them when they resume.
+func Listen(ctx context.Context, dsn string, hub *Hub, load func(context.Context, int64) (Event, error), onError func(error)) error {
+	listener := pq.NewListener(dsn, time.Second*10, time.Minute, func(_ pq.ListenerEventType, err error) {
+		if err != nil {
+			onError(err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(Channel); err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ping.C:
+			go listener.Ping()
+		case n := <-listener.Notify:
+			// nil after a reconnection
+			if n == nil {
+				continue
+			}
+
+			var e Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				onError(err)
+				continue
+			}
+
+			if e.Topic == "" {
+				loaded, err := load(ctx, e.ID)
+				if err != nil {
+					onError(err)
+					continue
+				}
+				e = loaded
+			}
+
+			hub.Deliver(e)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Package webhook posts events to the endpoints third-party integrations
+// register, signed so they can tell the requests come from us.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Headers sent along with every delivery.
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+var ErrPrivateAddress = errors.New("webhook url resolves to a private address")
+
+// NewSecret returns a random secret for signing the deliveries of a new endpoint.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature of body sent at timestamp, as in the signature
+// header: "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>".
+// Receivers compute the same and reject old timestamps to stop replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff is how long to wait before retrying a delivery that failed attempts
+// times, doubling from base with every attempt.
+func Backoff(base time.Duration, attempts int) time.Duration {
+	return base << max(attempts-1, 0)
+}
+
+// Request is a single delivery of an event to an endpoint.
+type Request struct {
+	URL        string
+	Secret     string
+	DeliveryID int64
+	Event      string
+	Payload    []byte
+}
+
+// Client posts deliveries, refusing to connect to private addresses unless told
+// to so that webhooks can't be pointed at our own network.
+type Client struct {
+	http *http.Client
+}
+
+func NewClient(timeout time.Duration, allowPrivate bool) *Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+				return ErrPrivateAddress
+			}
+
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &Client{
+		http: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			// a redirect would have the signed payload sent somewhere else
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Send posts req and returns the response status, any status outside of 2xx is
+// an error as well.
+func (c *Client) Send(ctx context.Context, req Request) (int, error) {
+	timestamp := time.Now().Unix()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("User-Agent", "GopherSocial-Webhooks")
+	r.Header.Set(EventHeader, req.Event)
+	r.Header.Set(DeliveryHeader, strconv.FormatInt(req.DeliveryID, 10))
+	r.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	r.Header.Set(SignatureHeader, Sign(req.Secret, timestamp, req.Payload))
+
+	res, err := c.http.Do(r)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// drain a little so the connection can be reused, receivers only need to ack
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("endpoint responded %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":1}`)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      []byte
+		want      string
+	}{
+		{"a delivery", "secret", 1700000000, body, "sha256=3dd1b9aef568d75f6790a84bd2e5dfa1f44409eef3cbdbd3f10b837376100c11"},
+		{"another timestamp", "secret", 1700000001, body, "sha256=d0c79a345e51a61362e0123dd2fc00ec01a78397760f2babc7a052bbbf46c313"},
+		{"another secret", "other", 1700000000, body, "sha256=e0cb77fc6d5b2877ec062213c262d236b5dd5a833d29fdc5a058c5fbfa287b47"},
+		{"an empty body", "secret", 0, nil, "sha256=3445798a051818ef95def46c2eb62b43d377ce6e3c29b4d0aec3da0e59577f79"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.timestamp, tt.body); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempts), func(t *testing.T) {
+			if got := Backoff(time.Minute, tt.attempts); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	status := http.StatusNoContent
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	req := Request{URL: server.URL, Secret: "secret", DeliveryID: 7, Event: "post.created", Payload: []byte(`{"id":1}`)}
+
+	t.Run("a signed delivery", func(t *testing.T) {
+		code, err := NewClient(time.Second, true).Send(context.Background(), req)
+		if err != nil || code != http.StatusNoContent {
+			t.Fatalf("got %d %v, want %d", code, err, http.StatusNoContent)
+		}
+
+		timestamp, err := strconv.ParseInt(got.Header.Get(TimestampHeader), 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sig := got.Header.Get(SignatureHeader); sig != Sign("secret", timestamp, gotBody) {
+			t.Errorf("signature %s doesn't match the body", sig)
+		}
+		if event := got.Header.Get(EventHeader); event != "post.created" {
+			t.Errorf("event header %q", event)
+		}
+		if id := got.Header.Get(DeliveryHeader); id != "7" {
+			t.Errorf("delivery header %q", id)
+		}
+	})
+
+	t.Run("a failing endpoint", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		defer func() { status = http.StatusNoContent }()
+
+		code, err := NewClient(time.Second, true).Send(context.Background(), req)
+		if err == nil || code != http.StatusInternalServerError {
+			t.Errorf("got %d %v, want %d and an error", code, err, http.StatusInternalServerError)
+		}
+	})
+
+	t.Run("private addresses are refused", func(t *testing.T) {
+		_, err := NewClient(time.Second, false).Send(context.Background(), req)
+		if !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("got %v, want %v", err, ErrPrivateAddress)
+		}
+	})
+}